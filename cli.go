@@ -1,17 +1,22 @@
 package main
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"os"
-	"strconv"
 	"text/tabwriter"
+	"text/template"
+	"time"
 
 	"github.com/yuuki/lsconntrack/conntrack"
-	"github.com/yuuki/lsconntrack/netutil"
+	"github.com/yuuki/lsconntrack/graph"
+	"github.com/yuuki/lsconntrack/ipfix"
+	"github.com/yuuki/lsconntrack/metrics"
+	"github.com/yuuki/lsconntrack/otlp"
+	"github.com/yuuki/lsconntrack/statsd"
 )
 
 const (
@@ -21,22 +26,10 @@ const (
 	exitCodeParseConntrackError
 	exitCodePrintError
 	exitCodeUnreachableError
+	exitCodeDifferenceFound
+	exitCodePolicyViolation
 )
 
-type portslice []string
-
-func (s *portslice) String() string {
-	return fmt.Sprintf("%s", *s)
-}
-
-func (s *portslice) Set(value string) error {
-	if _, err := strconv.Atoi(value); err != nil {
-		return fmt.Errorf("%s is not number", value)
-	}
-	*s = append(*s, value)
-	return nil
-}
-
 // CLI is the command line object.
 type CLI struct {
 	// outStream and errStream are the stdout and stderr
@@ -49,31 +42,66 @@ type CLI struct {
 func (c *CLI) Run(args []string) int {
 	log.SetOutput(c.errStream)
 
+	if len(args) > 1 {
+		switch args[1] {
+		case "snapshot":
+			return c.runSnapshot(args[2:])
+		case "diff":
+			return c.runDiff(args[2:])
+		case "check":
+			return c.runCheck(args[2:])
+		case "gen-rules":
+			return c.runGenRules(args[2:])
+		case "merge":
+			return c.runMerge(args[2:])
+		case "record":
+			return c.runRecord(args[2:])
+		case "history":
+			return c.runHistory(args[2:])
+		case "top":
+			return c.runTop(args[2:])
+		}
+	}
+
 	var (
-		active, passive           bool
-		activePorts, passivePorts portslice
-		numeric                   bool
-		stdin                     bool
-		json                      bool
-		ver                       bool
+		cl       collector
+		wt       watcher
+		json     bool
+		env      bool
+		format   string
+		weight   string
+		columns  string
+		noHeader bool
+		tmplText string
+		human    bool
+		push     string
+		statsdTo string
+		exportTo string
+		exportPr string
+		otlpTo   string
+		ver      bool
 	)
 	flags := flag.NewFlagSet("lsconntrack", flag.ContinueOnError)
 	flags.SetOutput(c.errStream)
 	flags.Usage = func() {
 		fmt.Fprint(c.errStream, helpText)
 	}
-	flags.BoolVar(&active, "a", false, "")
-	flags.BoolVar(&active, "active", false, "")
-	flags.BoolVar(&passive, "p", false, "")
-	flags.BoolVar(&passive, "passive", false, "")
-	flags.Var(&activePorts, "aport", "")
-	flags.Var(&activePorts, "active-port", "")
-	flags.Var(&passivePorts, "pport", "")
-	flags.Var(&passivePorts, "passive-port", "")
-	flags.BoolVar(&numeric, "n", false, "")
-	flags.BoolVar(&numeric, "numeric", false, "")
-	flags.BoolVar(&stdin, "stdin", false, "")
+	cl.setFlags(flags)
+	wt.setFlags(flags)
 	flags.BoolVar(&json, "json", false, "")
+	flags.BoolVar(&env, "json-envelope", false, "")
+	flags.StringVar(&format, "format", "table", "")
+	flags.StringVar(&weight, "weight", "bytes", "")
+	flags.StringVar(&columns, "columns", "", "")
+	flags.BoolVar(&noHeader, "no-header", false, "")
+	flags.StringVar(&tmplText, "template", "", "")
+	flags.BoolVar(&human, "H", false, "")
+	flags.BoolVar(&human, "human", false, "")
+	flags.StringVar(&push, "push", "", "")
+	flags.StringVar(&statsdTo, "statsd", "", "")
+	flags.StringVar(&exportTo, "export", "", "")
+	flags.StringVar(&exportPr, "export-protocol", "ipfix", "")
+	flags.StringVar(&otlpTo, "otlp", "", "")
 	flags.BoolVar(&ver, "version", false, "")
 	if err := flags.Parse(args[1:]); err != nil {
 		return exitCodeFlagParseError
@@ -83,112 +111,420 @@ func (c *CLI) Run(args []string) int {
 		fmt.Fprintf(c.errStream, "%s version %s, build %s, date %s \n", name, version, commit, date)
 		return exitCodeOK
 	}
-
-	var mode conntrack.FlowDirection
-	if active {
-		mode |= conntrack.FlowActive
+	if json || env {
+		format = "json"
 	}
-	if passive {
-		mode |= conntrack.FlowPassive
+	switch format {
+	case "table", "json", "ndjson", "csv", "tsv", "dot", "mermaid", "influx", "graphite":
+	default:
+		log.Printf("unknown format: %s\n", format)
+		return exitCodeArgumentsError
 	}
-	if !active && !passive {
-		mode = conntrack.FlowActive | conntrack.FlowPassive
+	if push != "" && format != "influx" && format != "graphite" {
+		log.Println("--push can be used only with --format influx or graphite")
+		return exitCodeArgumentsError
+	}
+	var tmpl *template.Template
+	if tmplText != "" {
+		var err error
+		tmpl, err = parseTemplate(tmplText)
+		if err != nil {
+			log.Println(err)
+			return exitCodeArgumentsError
+		}
+		format = "template"
+	}
+	cols, err := conntrack.ParseColumns(columns)
+	if err != nil {
+		log.Println(err)
+		return exitCodeArgumentsError
+	}
+	w, err := graph.ParseWeight(weight)
+	if err != nil {
+		log.Println(err)
+		return exitCodeArgumentsError
 	}
 
-	var r io.Reader
-	if stdin {
-		r = os.Stdin
-	} else {
-		path := netutil.FindConntrackPath()
-		if path == "" {
-			log.Println("not found conntrack entries path: Please load conntrack module")
-			return exitCodeParseConntrackError
+	sk := &sinks{statsdTo: statsdTo, exportTo: exportTo, otlpTo: otlpTo}
+	if statsdTo != "" {
+		if !wt.enabled() {
+			log.Println("--statsd can be used only with --watch")
+			return exitCodeArgumentsError
 		}
-		f, err := os.Open(path)
+		sk.sd, err = statsd.Dial(statsdTo)
 		if err != nil {
-			log.Printf("failed to open %v: %v\n", path, err)
-			return exitCodeParseConntrackError
+			log.Printf("failed to dial %v: %v\n", statsdTo, err)
+			return exitCodeArgumentsError
 		}
-		defer f.Close()
-		r = f
+		defer sk.sd.Close()
 	}
-
-	if mode&conntrack.FlowPassive != 0 && len(passivePorts) == 0 {
-		var err error
-		passivePorts, err = netutil.LocalListeningPorts()
+	if exportTo != "" {
+		if !wt.enabled() {
+			log.Println("--export can be used only with --watch")
+			return exitCodeArgumentsError
+		}
+		v, err := ipfix.ParseVersion(exportPr)
+		if err != nil {
+			log.Println(err)
+			return exitCodeArgumentsError
+		}
+		sk.ex, err = ipfix.Dial(exportTo, v, 0)
 		if err != nil {
-			log.Printf("failed to get local listening ports: %v\n", err)
-			return exitCodeParseConntrackError
+			log.Printf("failed to dial %v: %v\n", exportTo, err)
+			return exitCodeArgumentsError
 		}
+		defer sk.ex.Close()
 	}
-
-	flows, err := conntrack.ParseEntries(r, conntrack.FilterPorts{
-		Active:  activePorts,
-		Passive: passivePorts,
-	})
-	if err != nil {
-		log.Println(err)
-		return exitCodeParseConntrackError
+	if otlpTo != "" {
+		if !wt.enabled() {
+			log.Println("--otlp can be used only with --watch")
+			return exitCodeArgumentsError
+		}
+		sk.ot, err = otlp.NewExporter(otlpTo, version)
+		if err != nil {
+			log.Println(err)
+			return exitCodeArgumentsError
+		}
 	}
-	if json {
-		if err := c.PrintHostFlowsAsJSON(flows, numeric, mode); err != nil {
+
+	mode := cl.mode()
+	stats := &statFormatter{human: human}
+	tracker := conntrack.NewTracker()
+	output := func(t *tick, flows conntrack.HostFlows, resolve func(string) string) int {
+		if t != nil {
+			// the flows remember when they are seen in watch mode.
+			tracker.Observe(flows, t.at)
+		}
+		if sk.enabled() {
+			// the metrics are sent instead of printed.
+			sk.send(t, flows, resolve, mode, &cl.origin)
+			return exitCodeOK
+		}
+		var err error
+		switch format {
+		case "json":
+			if env {
+				err = c.PrintEnvelopeAsJSON(cl.envelope(flows), resolve, mode)
+			} else {
+				// the bare list carries the addresses of the host in each flow instead of the envelope.
+				for _, flow := range flows {
+					flow.HostAddrs = cl.origin.addrs
+				}
+				err = c.PrintHostFlowsAsJSON(flows, resolve, mode)
+			}
+		case "ndjson":
+			err = c.PrintHostFlowsAsNDJSON(t, flows, resolve, mode)
+		case "csv", "tsv":
+			comma := ','
+			if format == "tsv" {
+				comma = '\t'
+			}
+			// the header are printed only once in watch mode.
+			header := !noHeader && (t == nil || t.seq == 1)
+			err = c.PrintHostFlowsAsCSV(flows, resolve, mode, cols, comma, header)
+		case "template":
+			err = c.PrintHostFlowsWithTemplate(flows, resolve, mode, tmpl)
+		case "dot", "mermaid":
+			err = c.PrintHostFlowsAsGraph(flows, resolve, mode, format, w)
+		case "influx", "graphite":
+			err = c.PrintHostFlowsAsPoints(flows, resolve, mode, format, cl.origin.host, cl.origin.collectedAt, push)
+			if err != nil && push != "" && t != nil {
+				// the target unavailable for a while does not stop watching as well as --statsd and --export.
+				log.Printf("failed to push to %v: %v\n", push, err)
+				return exitCodeOK
+			}
+		default:
+			if t != nil {
+				fmt.Fprintf(c.outStream, "# %d %s\n", t.seq, t.at.Format(time.RFC3339))
+			}
+			stats.observe(t)
+			c.PrintHostFlows(flows, resolve, mode, stats)
+			stats.remember(flows)
+		}
+		if err != nil {
 			log.Println(err)
 			return exitCodePrintError
 		}
-	} else {
-		c.PrintHostFlows(flows, numeric, mode)
+		return exitCodeOK
 	}
 
-	return exitCodeOK
+	if wt.enabled() {
+		return wt.run(&cl, output)
+	}
+	flows, resolve, status := cl.collect()
+	if status != exitCodeOK {
+		return status
+	}
+	return output(nil, flows, resolve)
 }
 
 // PrintHostFlows prints the host flows.
-func (c *CLI) PrintHostFlows(flows conntrack.HostFlows, numeric bool, direction conntrack.FlowDirection) {
+// The addresses are replaced into the names by resolve unless it is nil.
+// The stat columns are formatted by stats, or printed as they are if it is nil.
+func (c *CLI) PrintHostFlows(flows conntrack.HostFlows, resolve func(string) string, direction conntrack.FlowDirection, stats *statFormatter) {
 	// Format in tab-separated columns with a tab stop of 8.
 	tw := tabwriter.NewWriter(c.outStream, 0, 8, 0, '\t', 0)
-	fmt.Fprintln(tw, "Local Address:Port\t <--> \tPeer Address:Port \tInpkts \tInbytes \tOutpkts \tOutbytes")
+	var labeled, translated, tracked bool
 	for _, flow := range flows {
+		if flow.Netns != "" {
+			labeled = true
+		}
+		if flow.NAT != nil {
+			translated = true
+		}
+		if flow.Seen != nil {
+			tracked = true
+		}
+	}
+	header := "Local Address:Port\t <--> \tPeer Address:Port \t" + stats.header()
+	if direction == conntrack.FlowForwarded {
+		header = "Client Address:Port\t --> \tServer Address:Port \t" + stats.header()
+	}
+	if labeled {
+		header = "Netns \t" + header
+	}
+	if tracked {
+		header = header + " \tFirst seen \tLast seen \tTotal inbytes \tTotal outbytes"
+	}
+	if translated {
+		header = header + " \tNAT"
+	}
+	fmt.Fprintln(tw, header)
+	for key, flow := range flows.Resolved(resolve) {
 		if flow.HasDirection(direction) {
 			continue
 		}
-		if !numeric {
-			flow.ReplaceLookupedName()
+		line := flow.Endpoints() + " \t" + stats.format(key, flow)
+		if labeled {
+			line = flow.Netns + " \t" + line
+		}
+		if tracked {
+			line = line + " \t" + formatSeen(flow.Seen, stats != nil && stats.human)
+		}
+		if translated {
+			line = line + " \t" + flow.NAT.String()
 		}
-		fmt.Fprintln(tw, flow)
+		fmt.Fprintln(tw, line)
 	}
 	tw.Flush()
 }
 
 // PrintHostFlowsAsJSON prints the host flows as json format.
-func (c *CLI) PrintHostFlowsAsJSON(flows conntrack.HostFlows, numeric bool, direction conntrack.FlowDirection) error {
-	for key, flow := range flows {
-		if !numeric {
-			flow.ReplaceLookupedName()
+// The addresses are replaced into the names by resolve unless it is nil.
+func (c *CLI) PrintHostFlowsAsJSON(flows conntrack.HostFlows, resolve func(string) string, direction conntrack.FlowDirection) error {
+	flows = flows.Filter(direction).Resolved(resolve)
+	return json.NewEncoder(c.outStream).Encode(flows)
+}
+
+// PrintHostFlowsAsCSV prints the columns of the host flows as CSV, or TSV if comma are '\t'.
+// The addresses are replaced into the names by resolve unless it is nil.
+func (c *CLI) PrintHostFlowsAsCSV(flows conntrack.HostFlows, resolve func(string) string, direction conntrack.FlowDirection, columns []*conntrack.Column, comma rune, header bool) error {
+	cw := csv.NewWriter(c.outStream)
+	cw.Comma = comma
+	if header {
+		names := make([]string, 0, len(columns))
+		for _, column := range columns {
+			names = append(names, column.Name)
 		}
-		if flow.HasDirection(direction) {
-			delete(flows, key)
+		cw.Write(names)
+	}
+	for _, flow := range flows.Filter(direction).Resolved(resolve).List() {
+		record := make([]string, 0, len(columns))
+		for _, column := range columns {
+			record = append(record, column.Value(flow))
 		}
+		cw.Write(record)
 	}
-	b, err := json.Marshal(flows)
-	if err != nil {
-		return err
+	cw.Flush()
+	return cw.Error()
+}
+
+// PrintHostFlowsWithTemplate prints each host flow by the template.
+// The addresses are replaced into the names by resolve unless it is nil.
+func (c *CLI) PrintHostFlowsWithTemplate(flows conntrack.HostFlows, resolve func(string) string, direction conntrack.FlowDirection, tmpl *template.Template) error {
+	for _, flow := range flows.Filter(direction).Resolved(resolve).List() {
+		if err := tmpl.Execute(c.outStream, flow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tickFlow are the host flow with the tick in watch mode.
+type tickFlow struct {
+	Seq       int       `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	*conntrack.HostFlow
+}
+
+// PrintHostFlowsAsNDJSON prints the host flows as newline delimited json, one flow per line.
+// The flows carry the sequence number and the timestamp of the tick unless t is nil.
+// The addresses are replaced into the names by resolve unless it is nil.
+func (c *CLI) PrintHostFlowsAsNDJSON(t *tick, flows conntrack.HostFlows, resolve func(string) string, direction conntrack.FlowDirection) error {
+	enc := json.NewEncoder(c.outStream)
+	for _, flow := range flows.Filter(direction).Resolved(resolve).List() {
+		var v interface{} = flow
+		if t != nil {
+			v = &tickFlow{Seq: t.seq, Timestamp: t.at, HostFlow: flow}
+		}
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
 	}
-	c.outStream.Write(b)
 	return nil
 }
 
+// PrintEnvelopeAsJSON prints the host flows with the metadata of the origin host as json format.
+// The addresses are replaced into the names by resolve unless it is nil.
+func (c *CLI) PrintEnvelopeAsJSON(env *conntrack.Envelope, resolve func(string) string, direction conntrack.FlowDirection) error {
+	env.Flows = env.Flows.Filter(direction).Resolved(resolve)
+	return json.NewEncoder(c.outStream).Encode(env)
+}
+
+// PrintHostFlowsAsGraph prints the host flows as Graphviz DOT or Mermaid format.
+// The addresses are replaced into the names by resolve unless it is nil.
+func (c *CLI) PrintHostFlowsAsGraph(flows conntrack.HostFlows, resolve func(string) string, direction conntrack.FlowDirection, format string, weight graph.Weight) error {
+	flows = flows.Filter(direction).Resolved(resolve)
+	if format == "mermaid" {
+		return graph.WriteMermaid(c.outStream, flows, weight)
+	}
+	return graph.WriteDOT(c.outStream, flows, weight)
+}
+
+// PrintHostFlowsAsPoints prints the host flows as the points of InfluxDB line protocol or Graphite plaintext protocol.
+// The points are pushed to the target instead if it is not empty.
+func (c *CLI) PrintHostFlowsAsPoints(flows conntrack.HostFlows, resolve func(string) string, direction conntrack.FlowDirection, format string, host string, at time.Time, push string) error {
+	flows = flows.Filter(direction).Resolved(resolve)
+	w := c.outStream
+	if push != "" {
+		pw, err := openPush(push)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", push, err)
+		}
+		defer pw.Close()
+		w = pw
+	}
+	points := metrics.Points(flows, host, at)
+	if format == "graphite" {
+		return metrics.WriteGraphite(w, points)
+	}
+	return metrics.WriteInflux(w, points)
+}
+
+// sendHostFlowsToStatsD sends the deltas of the host flows since the previous round to StatsD.
+// The addresses are replaced into the names by resolve unless it is nil.
+func sendHostFlowsToStatsD(sd *statsd.Client, flows conntrack.HostFlows, resolve func(string) string, direction conntrack.FlowDirection, host string) error {
+	flows = flows.Filter(direction).Resolved(resolve)
+	return sd.Send(flows, host)
+}
+
+// exportHostFlowsToOTLP exports the host flows aggregated as well as PrintHostFlowsAsJSON to the OTLP collector.
+// The addresses are replaced into the names by resolve unless it is nil.
+func exportHostFlowsToOTLP(ot *otlp.Exporter, flows conntrack.HostFlows, resolve func(string) string, direction conntrack.FlowDirection, host string, at time.Time) error {
+	flows = flows.Filter(direction).Resolved(resolve)
+	return ot.Export(flows, host, at)
+}
+
+// arrow returns the arrow from the client to the server of the flow.
+func arrow(flow *conntrack.HostFlow) string {
+	if flow.Direction == conntrack.FlowPassive {
+		return "<--"
+	}
+	return "-->"
+}
+
 var helpText = `Usage: lsconntrack [options]
+       lsconntrack snapshot [-o FILE]
+       lsconntrack diff [--threshold PERCENT] [--json] OLD NEW
+       lsconntrack check --policy FILE [--format table|json|junit] [options]
+       lsconntrack gen-rules [--format iptables|nftables|ufw] [--prefix BITS] [options]
+       lsconntrack merge [--format json|dot|mermaid|csv] [--weight bytes|conns] FILE|DIR...
+       lsconntrack record --db FILE [--interval DURATION] [--retention DURATION] [--downsample DURATION] [options]
+       lsconntrack history --db FILE [--since DURATION | --stale DURATION] [--peer ADDR|CIDR] [--json]
+       lsconntrack top [--interval DURATION] [options]
 
   Print host flows between localhost and other hosts
 
+Commands:
+  snapshot                  write the conntrack table with the local addresses, listening ports,
+                            ephemeral port range, hostname, kernel version and timestamp into
+                            a versioned archive (-o, --output FILE: default stdout)
+  diff                      compare two outputs of --json or two snapshots and print the flows that are
+                            new, gone or changed by more than --threshold percent (default: 50) in bytes
+                            or connections. It exits with non-zero status if there are differences.
+  check                     evaluate the host flows against the policy of the allowed flows in json format
+                            and print the violations. It exits with non-zero status if there are violations.
+  gen-rules                 print the firewall rules allowing the passive flows by source network (ingress)
+                            and the active flows by destination network and port (egress). The peers are
+                            rolled up into the networks of --prefix bits (default: 32) and merged.
+  merge                     join the outputs of --json from many hosts, or the json files in the directories,
+                            into the cluster flows from the client host to the server host and port. The active
+                            and passive flows of the same connections are paired and counted once.
+  record                    append the host flows to the db file every --interval (default: 1m). The records
+                            older than --retention (default: 7d) are removed, and those older than
+                            --downsample-after (default: 1d) are merged into one per --downsample (default: 1h).
+  history                   print the host flows recorded in the db file since --since (default: 24h) ago,
+                            whose peer is --peer. --stale prints the flows not seen for the duration such as 7d
+                            with when they are seen first and last and their total bytes instead.
+  top                       show the host flows in the full-screen terminal UI refreshing every --interval
+                            (default: 1s) with the rates. The keys are 1-7 to sort by the column (again to
+                            reverse), d to filter by direction, / by peer, : by port, c to clear the filters,
+                            up/down (j/k) to select, enter to show the conntrack entries of the flow and q to quit.
+
 Options:
   --active, -a              print active-open host flows (from localhost to other host).
   --passive, -p             print passive-open host flows (from other host to localhost).
-  --active-port, --aport    output filter by active-open destination ports
+  --active-port, --aport    output filter by active-open (or forwarded) destination ports
   --passive-port, --pport   output filter by localhost listening ports (default: all listening local ports)
+  --forwarded               print host flows forwarded by localhost between other hosts (client --> server).
+  --client-cidr CIDR        aggregate the forwarded flows from clients in the CIDR
+  --by-server               aggregate the forwarded flows by server address and port regardless of clients
   --numeric, -n             show numerical addresses instead of trying to determine symbolic host, port names.
+  --owner                   print the container, systemd unit or cgroup owning the local endpoint instead of localhost
+  --netns NAME|PATH|pid:N   inspect the network namespace named in /var/run/netns, at the path or of the process
+  --all-netns               inspect all the network namespaces and label each flow with its namespace
+  --k8s-state FILE          map addresses into Pod and Service names by the output of
+                            'kubectl get pods,svc,endpoints -o json' or the kubelet pods
+  --local-addr ADDR|CIDR    regard the address as local instead of the addresses of this host (repeatable)
+  --listen-ports-file FILE  regard the ports as listening, one port per line or the output of 'ss -tln' or 'netstat -tln'
+  --capture FILE            input conntrack entries bundled with the local addresses and listening ports
+  --from-snapshot FILE      input conntrack entries from the snapshot written by 'lsconntrack snapshot'
+  --ephemeral-ports MIN-MAX guess the direction of connections on unknown local ports by the ephemeral
+                            port range (default: net.ipv4.ip_local_port_range), marked with '?'
+  --hostname NAME           label the flows with the hostname (default: the hostname of this host or the snapshot)
   --stdin                   input conntrack entries via stdin
   --json                    print results as json format
+  --json-envelope           print results as json format enveloped with the host, addresses, collected time,
+                            kernel, version, source and the number of parse errors
+  --format FORMAT           print results as table (default), json, ndjson (one flow per line), csv, tsv,
+                            dot (Graphviz), mermaid, influx (InfluxDB line protocol) or graphite (tagged
+                            plaintext protocol) format
+  --push TARGET             push the influx or graphite points to unix:///path, tcp://host:port,
+                            udp://host:port or the file appended to, instead of printing them
+  --columns COLUMNS         print the comma separated columns in csv and tsv format
+                            (default: direction,local_addr,local_port,peer_addr,peer_port,in_packets,
+                            in_bytes,out_packets,out_bytes,conns; also host,netns,direction_reason,nat,nat_detail,
+                            and first_seen,last_seen,total_in_packets,total_in_bytes,total_out_packets,
+                            total_out_bytes,peak_conns in watch mode)
+  --no-header               print no header line in csv and tsv format
+  --template TEMPLATE       print each flow by the Go template such as '{{.Peer.Addr}}:{{.Peer.Port}}'
+                            with the functions humanize (bytes), inCIDR CIDR ADDR, pad WIDTH and lpad WIDTH
+  --weight bytes|conns      weight the edges of the dot and mermaid graphs by bytes (default) or connections
+  -H, --human               print the bytes in KiB, MiB or GiB and the packets in k or M in the table,
+                            and the inbound and outbound bytes per second in watch mode
+  --statsd HOST:PORT        send the bytes and packets since the previous round as the counters and the
+                            connections as the gauges with DogStatsD tags over UDP in watch mode,
+                            instead of printing them
+  --export HOST:PORT        export the bytes and packets since the previous round of each flow as the records
+                            from the client to the server and back to the flow collector over UDP in watch mode,
+                            instead of printing them
+  --export-protocol PROTO   export the records in ipfix (default, RFC 7011) or netflow9 (NetFlow v9)
+  --otlp URL                export the bytes and packets since the previous round as the delta sums and the
+                            connections as the gauges of OTLP metrics to the collector such as
+                            http://localhost:4318 over HTTP in JSON in watch mode, instead of printing them
+  --watch INTERVAL          print results every interval such as 5s. The ndjson flows carry the sequence
+                            number and the timestamp of each round (seq and timestamp)
+  --count N                 stop after N rounds in watch mode (default: 0 = forever)
   --version, -v	            print version
   --help, -h                print help
 `
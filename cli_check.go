@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/policy"
+)
+
+// runCheck evaluates the host flows against the policy.
+func (c *CLI) runCheck(args []string) int {
+	var (
+		cl         collector
+		policyFile string
+		format     string
+	)
+	flags := flag.NewFlagSet("lsconntrack check", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+	flags.Usage = func() {
+		fmt.Fprint(c.errStream, helpText)
+	}
+	cl.setFlags(flags)
+	flags.StringVar(&policyFile, "policy", "", "")
+	flags.StringVar(&format, "format", "table", "")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeFlagParseError
+	}
+	if policyFile == "" {
+		log.Println("--policy is required")
+		return exitCodeArgumentsError
+	}
+	switch format {
+	case "table", "json", "junit":
+	default:
+		log.Printf("unknown format: %s\n", format)
+		return exitCodeArgumentsError
+	}
+
+	f, err := os.Open(policyFile)
+	if err != nil {
+		log.Printf("failed to open %v: %v\n", policyFile, err)
+		return exitCodeArgumentsError
+	}
+	p, err := policy.Load(f)
+	f.Close()
+	if err != nil {
+		log.Println(err)
+		return exitCodeArgumentsError
+	}
+
+	// the rules match the numerical addresses, so that the names are not resolved.
+	flows, _, status := cl.collect()
+	if status != exitCodeOK {
+		return status
+	}
+	results := p.Evaluate(flows.Filter(cl.mode()))
+	violations := policy.Violations(results)
+
+	switch format {
+	case "json":
+		err = json.NewEncoder(c.outStream).Encode(violations)
+	case "junit":
+		err = printJUnit(c.outStream, results, len(violations))
+	default:
+		c.PrintViolations(violations)
+	}
+	if err != nil {
+		log.Println(err)
+		return exitCodePrintError
+	}
+	if len(violations) > 0 {
+		return exitCodePolicyViolation
+	}
+	return exitCodeOK
+}
+
+// PrintViolations prints the host flows allowed by no rules.
+func (c *CLI) PrintViolations(violations []*policy.Result) {
+	// Format in tab-separated columns with a tab stop of 8.
+	tw := tabwriter.NewWriter(c.outStream, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(tw, "Violation \tLocal Address:Port\t <--> \tPeer Address:Port \tInpkts \tInbytes \tOutpkts \tOutbytes")
+	for _, v := range violations {
+		fmt.Fprintf(tw, "%s \t%s\n", v.Flow.Direction, v.Flow)
+	}
+	tw.Flush()
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitTestCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// printJUnit prints the results as JUnit XML, in which each flow is a test case.
+func printJUnit(w io.Writer, results []*policy.Result, failures int) error {
+	suite := junitTestSuite{Name: "lsconntrack", Tests: len(results), Failures: failures}
+	for _, r := range results {
+		tc := junitTestCase{
+			Classname: r.Flow.Direction.String(),
+			Name:      flowLabel(r.Flow),
+		}
+		if !r.Allowed() {
+			tc.Failure = &junitFailure{Message: "no rule allows " + flowLabel(r.Flow)}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// flowLabel returns the endpoints of the flow such as "localhost:many --> 10.0.1.10:3306".
+func flowLabel(flow *conntrack.HostFlow) string {
+	return fmt.Sprintf("%s %s %s", flow.Local, arrow(flow), flow.Peer)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"text/tabwriter"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+// runDiff compares two host flows printed as json format or two snapshots.
+func (c *CLI) runDiff(args []string) int {
+	var (
+		threshold float64
+		json      bool
+	)
+	flags := flag.NewFlagSet("lsconntrack diff", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+	flags.Usage = func() {
+		fmt.Fprint(c.errStream, helpText)
+	}
+	flags.Float64Var(&threshold, "threshold", 50, "")
+	flags.BoolVar(&json, "json", false, "")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeFlagParseError
+	}
+	if flags.NArg() != 2 {
+		log.Println("diff requires two files: OLD NEW")
+		return exitCodeArgumentsError
+	}
+
+	older, status := readFlowsFile(flags.Arg(0))
+	if status != exitCodeOK {
+		return status
+	}
+	newer, status := readFlowsFile(flags.Arg(1))
+	if status != exitCodeOK {
+		return status
+	}
+
+	diffs := conntrack.Diff(older, newer, threshold)
+	if json {
+		if err := c.PrintFlowDiffsAsJSON(diffs); err != nil {
+			log.Println(err)
+			return exitCodePrintError
+		}
+	} else {
+		c.PrintFlowDiffs(diffs)
+	}
+	if len(diffs) > 0 {
+		return exitCodeDifferenceFound
+	}
+	return exitCodeOK
+}
+
+// readFlowsFile reads the host flows printed by --json or --json-envelope,
+// or analyses the snapshot written by 'lsconntrack snapshot'.
+func readFlowsFile(path string) (conntrack.HostFlows, int) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("failed to read %v: %v\n", path, err)
+		return nil, exitCodeArgumentsError
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		flows, err := conntrack.ReadHostFlows(bytes.NewReader(b))
+		if err != nil {
+			log.Printf("failed to read %v: %v\n", path, err)
+			return nil, exitCodeArgumentsError
+		}
+		return flows, exitCodeOK
+	}
+	// the snapshot are also json if not gzipped.
+	if env, err := conntrack.ReadEnvelope(bytes.NewReader(b)); err == nil {
+		return env.Flows, exitCodeOK
+	}
+	cl := collector{snapshotFile: path, numeric: true}
+	flows, _, status := cl.collect()
+	return flows, status
+}
+
+// PrintFlowDiffs prints the differences of the host flows.
+func (c *CLI) PrintFlowDiffs(diffs []*conntrack.FlowDiff) {
+	// Format in tab-separated columns with a tab stop of 8.
+	tw := tabwriter.NewWriter(c.outStream, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(tw, "Change \tLocal Address:Port\t <--> \tPeer Address:Port \tBytes \tConns")
+	for _, d := range diffs {
+		fmt.Fprintf(tw, "%s \t%s\t %s \t%s \t%s -> %s \t%s -> %s\n", d.Type, d.Flow.Local, arrow(d.Flow), d.Flow.Peer,
+			statValue(d.Old, bytesOf), statValue(d.New, bytesOf),
+			statValue(d.Old, connsOf), statValue(d.New, connsOf))
+	}
+	tw.Flush()
+}
+
+// PrintFlowDiffsAsJSON prints the differences of the host flows as json format.
+func (c *CLI) PrintFlowDiffsAsJSON(diffs []*conntrack.FlowDiff) error {
+	return json.NewEncoder(c.outStream).Encode(diffs)
+}
+
+func bytesOf(s *conntrack.HostFlowStat) int64 {
+	return s.TotalInboundBytes + s.TotalOutboundBytes
+}
+
+func connsOf(s *conntrack.HostFlowStat) int64 {
+	return s.TotalConnections
+}
+
+// statValue returns the value of the stat or "-" if the stat is nil.
+func statValue(s *conntrack.HostFlowStat, value func(*conntrack.HostFlowStat) int64) string {
+	if s == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d", value(s))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/yuuki/lsconntrack/firewall"
+)
+
+// runGenRules prints the firewall rules allowing the observed host flows.
+func (c *CLI) runGenRules(args []string) int {
+	var (
+		cl     collector
+		format string
+		prefix int
+	)
+	flags := flag.NewFlagSet("lsconntrack gen-rules", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+	flags.Usage = func() {
+		fmt.Fprint(c.errStream, helpText)
+	}
+	cl.setFlags(flags)
+	flags.StringVar(&format, "format", "iptables", "")
+	flags.IntVar(&prefix, "prefix", 32, "")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeFlagParseError
+	}
+	if prefix < 0 || prefix > 32 {
+		log.Printf("--prefix should be between 0 and 32: %d\n", prefix)
+		return exitCodeArgumentsError
+	}
+	var write func(rules []*firewall.Rule) error
+	switch format {
+	case "iptables":
+		write = func(rules []*firewall.Rule) error { return firewall.WriteIPTables(c.outStream, rules) }
+	case "nftables":
+		write = func(rules []*firewall.Rule) error { return firewall.WriteNftables(c.outStream, rules) }
+	case "ufw":
+		write = func(rules []*firewall.Rule) error { return firewall.WriteUFW(c.outStream, rules) }
+	default:
+		log.Printf("unknown format: %s\n", format)
+		return exitCodeArgumentsError
+	}
+	if cl.forwarded {
+		log.Println("--forwarded cannot be used with gen-rules")
+		return exitCodeArgumentsError
+	}
+
+	// the rules need the numerical addresses, so that the names are not resolved.
+	flows, _, status := cl.collect()
+	if status != exitCodeOK {
+		return status
+	}
+	rules := firewall.Rules(flows.Filter(cl.mode()), prefix)
+	if err := write(rules); err != nil {
+		log.Println(err)
+		return exitCodePrintError
+	}
+	return exitCodeOK
+}
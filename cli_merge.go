@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/graph"
+	"github.com/yuuki/lsconntrack/servicemap"
+)
+
+// runMerge joins the outputs of --json from many hosts into the cluster flows.
+func (c *CLI) runMerge(args []string) int {
+	var format, weight string
+	flags := flag.NewFlagSet("lsconntrack merge", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+	flags.Usage = func() {
+		fmt.Fprint(c.errStream, helpText)
+	}
+	flags.StringVar(&format, "format", "json", "")
+	flags.StringVar(&weight, "weight", "bytes", "")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeFlagParseError
+	}
+	switch format {
+	case "json", "dot", "mermaid", "csv":
+	default:
+		log.Printf("unknown format: %s\n", format)
+		return exitCodeArgumentsError
+	}
+	w, err := graph.ParseWeight(weight)
+	if err != nil {
+		log.Println(err)
+		return exitCodeArgumentsError
+	}
+	if flags.NArg() == 0 {
+		log.Println("merge requires the files or directories of the outputs of --json")
+		return exitCodeArgumentsError
+	}
+
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		log.Println(err)
+		return exitCodeArgumentsError
+	}
+	hosts := make([]*servicemap.Host, 0, len(paths))
+	for _, path := range paths {
+		host, err := readHostFile(path)
+		if err != nil {
+			log.Printf("failed to read %v: %v\n", path, err)
+			return exitCodeArgumentsError
+		}
+		if len(host.Addrs) == 0 {
+			// the numerical peers of the other hosts cannot be paired with the flows of the host.
+			log.Printf("%v has no addresses of %v, whose flows are paired only by the hostname\n", path, host.Name)
+		}
+		hosts = append(hosts, host)
+	}
+
+	flows := servicemap.Merge(hosts)
+	switch format {
+	case "dot":
+		err = graph.WriteDOT(c.outStream, flows, w)
+	case "mermaid":
+		err = graph.WriteMermaid(c.outStream, flows, w)
+	case "csv":
+		err = servicemap.WriteCSV(c.outStream, flows)
+	default:
+		err = c.PrintHostFlowsAsJSON(flows, nil, conntrack.FlowActive|conntrack.FlowForwarded)
+	}
+	if err != nil {
+		log.Println(err)
+		return exitCodePrintError
+	}
+	return exitCodeOK
+}
+
+// expandPaths replaces the directories into the json files in them.
+func expandPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(arg, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, files...)
+	}
+	return paths, nil
+}
+
+// readHostFile reads the output of --json or --json-envelope from a host.
+// The host are named by the file name if the flows are not labeled with the hostname.
+// The addresses of the host are those of the envelope, or of the flows of --json.
+func readHostFile(path string) (*servicemap.Host, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	env, err := conntrack.ReadEnvelope(f)
+	if err != nil {
+		return nil, err
+	}
+	host := &servicemap.Host{Name: env.Host, Addrs: env.Addrs, Flows: env.Flows}
+	for _, flow := range env.Flows {
+		if host.Name != "" {
+			break
+		}
+		host.Name = flow.Host
+	}
+	if host.Name == "" {
+		host.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if len(host.Addrs) == 0 {
+		seen := map[string]bool{}
+		for _, flow := range env.Flows {
+			for _, addr := range flow.HostAddrs {
+				if !seen[addr] {
+					seen[addr] = true
+					host.Addrs = append(host.Addrs, addr)
+				}
+			}
+		}
+	}
+	return host, nil
+}
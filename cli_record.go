@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/store"
+)
+
+// duration are time.Duration that also accepts the days such as '7d'.
+type duration time.Duration
+
+func (d *duration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *duration) Set(value string) error {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(value, "d"), 64)
+		if err != nil || days < 0 {
+			return fmt.Errorf("%s is not duration", value)
+		}
+		*d = duration(days * float64(24*time.Hour))
+		return nil
+	}
+	v, err := time.ParseDuration(value)
+	if err != nil || v < 0 {
+		return fmt.Errorf("%s is not duration", value)
+	}
+	*d = duration(v)
+	return nil
+}
+
+// compactInterval are the interval to compact the db while recording.
+const compactInterval = time.Hour
+
+// runRecord appends the host flows to the db every interval.
+func (c *CLI) runRecord(args []string) int {
+	var (
+		cl              collector
+		wt              watcher
+		path            string
+		retention       = duration(7 * 24 * time.Hour)
+		resolution      = duration(time.Hour)
+		downsampleAfter = duration(24 * time.Hour)
+	)
+	flags := flag.NewFlagSet("lsconntrack record", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+	flags.Usage = func() {
+		fmt.Fprint(c.errStream, helpText)
+	}
+	cl.setFlags(flags)
+	flags.StringVar(&path, "db", "", "")
+	flags.DurationVar(&wt.interval, "interval", time.Minute, "")
+	flags.IntVar(&wt.count, "count", 0, "")
+	flags.Var(&retention, "retention", "")
+	flags.Var(&resolution, "downsample", "")
+	flags.Var(&downsampleAfter, "downsample-after", "")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeFlagParseError
+	}
+	if path == "" {
+		log.Println("--db is required")
+		return exitCodeArgumentsError
+	}
+	if wt.interval <= 0 {
+		log.Println("--interval should be positive")
+		return exitCodeArgumentsError
+	}
+
+	db := store.Open(path)
+	// the flows remember when they are seen across the restarts of recording.
+	tracker, status := replay(db, path)
+	if status != exitCodeOK {
+		return status
+	}
+	policy := store.Policy{
+		Retention:       time.Duration(retention),
+		Resolution:      time.Duration(resolution),
+		DownsampleAfter: time.Duration(downsampleAfter),
+	}
+	var compactedAt time.Time
+	return wt.run(&cl, func(t *tick, flows conntrack.HostFlows, _ func(string) string) int {
+		// the addresses are recorded as they are to be queried by the peer address.
+		flows = flows.Filter(cl.mode())
+		tracker.Observe(flows, t.at)
+		r := &store.Record{At: t.at, Host: cl.origin.host, Flows: flows}
+		if err := db.Append(r); err != nil {
+			log.Printf("failed to append to %v: %v\n", path, err)
+			return exitCodePrintError
+		}
+		if t.at.Sub(compactedAt) >= compactInterval {
+			if err := db.Compact(t.at, policy); err != nil {
+				log.Printf("failed to compact %v: %v\n", path, err)
+				return exitCodePrintError
+			}
+			compactedAt = t.at
+		}
+		return exitCodeOK
+	})
+}
+
+// replay returns the tracker that has restored the flows seen in the db.
+func replay(db *store.DB, path string) (*conntrack.Tracker, int) {
+	tracker := conntrack.NewTracker()
+	flows, err := db.Seen()
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to read %v: %v\n", path, err)
+		return nil, exitCodeArgumentsError
+	}
+	tracker.Restore(flows)
+	return tracker, exitCodeOK
+}
+
+// runHistory prints the host flows recorded in the db.
+func (c *CLI) runHistory(args []string) int {
+	var (
+		path  string
+		since = duration(24 * time.Hour)
+		stale duration
+		peer  string
+		json  bool
+	)
+	flags := flag.NewFlagSet("lsconntrack history", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+	flags.Usage = func() {
+		fmt.Fprint(c.errStream, helpText)
+	}
+	flags.StringVar(&path, "db", "", "")
+	flags.Var(&since, "since", "")
+	flags.Var(&stale, "stale", "")
+	flags.StringVar(&peer, "peer", "", "")
+	flags.BoolVar(&json, "json", false, "")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeFlagParseError
+	}
+	if path == "" {
+		log.Println("--db is required")
+		return exitCodeArgumentsError
+	}
+	match, err := peerMatcher(peer)
+	if err != nil {
+		log.Println(err)
+		return exitCodeArgumentsError
+	}
+
+	db := store.Open(path)
+	if stale > 0 {
+		return c.runStale(db, path, time.Duration(stale), match, json)
+	}
+
+	records, err := db.Records(time.Now().Add(-time.Duration(since)))
+	if err != nil {
+		log.Printf("failed to read %v: %v\n", path, err)
+		return exitCodeArgumentsError
+	}
+	matched := []*store.Record{}
+	for _, r := range records {
+		flows := conntrack.HostFlows{}
+		for key, flow := range r.Flows {
+			if match(flow) {
+				flows[key] = flow
+			}
+		}
+		if len(flows) > 0 {
+			matched = append(matched, &store.Record{At: r.At, Host: r.Host, Flows: flows})
+		}
+	}
+
+	if json {
+		if err := c.PrintRecordsAsJSON(matched); err != nil {
+			log.Println(err)
+			return exitCodePrintError
+		}
+		return exitCodeOK
+	}
+	c.PrintRecords(matched)
+	return exitCodeOK
+}
+
+// runStale prints the flows of the records in the db not seen for the duration.
+func (c *CLI) runStale(db *store.DB, path string, d time.Duration, match func(*conntrack.HostFlow) bool, json bool) int {
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("failed to read %v: %v\n", path, err)
+		return exitCodeArgumentsError
+	}
+	tracker, status := replay(db, path)
+	if status != exitCodeOK {
+		return status
+	}
+	stale := []*conntrack.HostFlow{}
+	for _, flow := range tracker.Stale(time.Now().Add(-d)) {
+		if match(flow) {
+			stale = append(stale, flow)
+		}
+	}
+	if json {
+		if err := c.PrintStaleFlowsAsJSON(stale); err != nil {
+			log.Println(err)
+			return exitCodePrintError
+		}
+		return exitCodeOK
+	}
+	c.PrintStaleFlows(stale)
+	return exitCodeOK
+}
+
+// peerMatcher returns whether the peer, or the client of the forwarded flow, is the address or in the CIDR.
+// It matches any flows if addr is empty.
+func peerMatcher(addr string) (func(*conntrack.HostFlow) bool, error) {
+	if addr == "" {
+		return func(*conntrack.HostFlow) bool { return true }, nil
+	}
+	if !strings.Contains(addr, "/") {
+		return func(flow *conntrack.HostFlow) bool {
+			return flow.Peer.Addr == addr || (flow.Direction == conntrack.FlowForwarded && flow.Local.Addr == addr)
+		}, nil
+	}
+	_, ipnet, err := net.ParseCIDR(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither IP address nor CIDR", addr)
+	}
+	contains := func(s string) bool {
+		ip := net.ParseIP(s)
+		return ip != nil && ipnet.Contains(ip)
+	}
+	return func(flow *conntrack.HostFlow) bool {
+		return contains(flow.Peer.Addr) || (flow.Direction == conntrack.FlowForwarded && contains(flow.Local.Addr))
+	}, nil
+}
+
+// PrintRecords prints the host flows of the records in order of time.
+func (c *CLI) PrintRecords(records []*store.Record) {
+	// Format in tab-separated columns with a tab stop of 8.
+	tw := tabwriter.NewWriter(c.outStream, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(tw, "Time \tHost \tLocal Address:Port\t <--> \tPeer Address:Port \tInpkts \tInbytes \tOutpkts \tOutbytes \tConns")
+	for _, r := range records {
+		host := r.Host
+		if host == "" {
+			host = "-"
+		}
+		for _, flow := range r.Flows.List() {
+			fmt.Fprintf(tw, "%s \t%s \t%s \t%d\n", r.At.Format(time.RFC3339), host, flow, flow.Stat.TotalConnections)
+		}
+	}
+	tw.Flush()
+}
+
+// PrintStaleFlows prints the flows not seen recently in order of the last seen time.
+func (c *CLI) PrintStaleFlows(flows []*conntrack.HostFlow) {
+	// Format in tab-separated columns with a tab stop of 8.
+	tw := tabwriter.NewWriter(c.outStream, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(tw, "Host \tLocal Address:Port\t <--> \tPeer Address:Port \tFirst seen \tLast seen \tTotal inbytes \tTotal outbytes")
+	for _, flow := range flows {
+		host := flow.Host
+		if host == "" {
+			host = "-"
+		}
+		fmt.Fprintf(tw, "%s \t%s \t%s\n", host, flow.Endpoints(), formatSeen(flow.Seen, false))
+	}
+	tw.Flush()
+}
+
+// PrintStaleFlowsAsJSON prints the flows not seen recently as json format.
+func (c *CLI) PrintStaleFlowsAsJSON(flows []*conntrack.HostFlow) error {
+	return json.NewEncoder(c.outStream).Encode(flows)
+}
+
+// PrintRecordsAsJSON prints the records as json format.
+func (c *CLI) PrintRecordsAsJSON(records []*store.Record) error {
+	return json.NewEncoder(c.outStream).Encode(records)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/yuuki/lsconntrack/snapshot"
+)
+
+// runSnapshot writes the snapshot of this host.
+func (c *CLI) runSnapshot(args []string) int {
+	var output string
+	flags := flag.NewFlagSet("lsconntrack snapshot", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+	flags.Usage = func() {
+		fmt.Fprint(c.errStream, helpText)
+	}
+	flags.StringVar(&output, "o", "-", "")
+	flags.StringVar(&output, "output", "-", "")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeFlagParseError
+	}
+	if flags.NArg() > 0 {
+		log.Printf("unexpected arguments: %v\n", flags.Args())
+		return exitCodeArgumentsError
+	}
+
+	snap, err := snapshot.Take()
+	if err != nil {
+		log.Println(err)
+		return exitCodeParseConntrackError
+	}
+
+	if output == "-" {
+		if err := snap.Write(c.outStream); err != nil {
+			log.Println(err)
+			return exitCodePrintError
+		}
+		return exitCodeOK
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		log.Println(err)
+		return exitCodePrintError
+	}
+	if err := snap.Write(f); err != nil {
+		f.Close()
+		log.Println(err)
+		return exitCodePrintError
+	}
+	if err := f.Close(); err != nil {
+		log.Println(err)
+		return exitCodePrintError
+	}
+	return exitCodeOK
+}
@@ -2,8 +2,22 @@ package main
 
 import (
 	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/conntrack/conntracktest"
+	"github.com/yuuki/lsconntrack/ipfix"
+	"github.com/yuuki/lsconntrack/otlp"
+	"github.com/yuuki/lsconntrack/snapshot"
+	"github.com/yuuki/lsconntrack/store"
 )
 
 func TestRun_global(t *testing.T) {
@@ -20,6 +34,84 @@ func TestRun_global(t *testing.T) {
 			expectedStatus: exitCodeFlagParseError,
 			expectedSubErr: "flag provided but not defined",
 		},
+		{
+			desc:           "stdin with netns",
+			arg:            "lsconntrack --stdin --netns blue",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "--stdin cannot be used with --netns or --all-netns",
+		},
+		{
+			desc:           "unknown format",
+			arg:            "lsconntrack --format xml",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "unknown format: xml",
+		},
+		{
+			desc:           "unknown weight",
+			arg:            "lsconntrack --format dot --weight packets",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "unknown weight: packets",
+		},
+		{
+			desc:           "invalid template",
+			arg:            "lsconntrack --template {{.Peer",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "template: lsconntrack",
+		},
+		{
+			desc:           "watch stdin",
+			arg:            "lsconntrack --format ndjson --watch 1s --stdin",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "--watch cannot be used with --stdin, --capture or --from-snapshot",
+		},
+		{
+			desc:           "push table",
+			arg:            "lsconntrack --push /tmp/lsconntrack.influx",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "--push can be used only with --format influx or graphite",
+		},
+		{
+			desc:           "statsd without watch",
+			arg:            "lsconntrack --statsd localhost:8125",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "--statsd can be used only with --watch",
+		},
+		{
+			desc:           "export without watch",
+			arg:            "lsconntrack --export localhost:4739",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "--export can be used only with --watch",
+		},
+		{
+			desc:           "otlp without watch",
+			arg:            "lsconntrack --otlp http://localhost:4318",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "--otlp can be used only with --watch",
+		},
+		{
+			desc:           "unknown export protocol",
+			arg:            "lsconntrack --export localhost:4739 --export-protocol sflow --watch 1s",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "unknown export protocol: sflow",
+		},
+		{
+			desc:           "record without db",
+			arg:            "lsconntrack record --interval 1s",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "--db is required",
+		},
+		{
+			desc:           "history with invalid since",
+			arg:            "lsconntrack history --db flows.db --since 1w",
+			expectedStatus: exitCodeFlagParseError,
+			expectedSubErr: "1w is not duration",
+		},
+		{
+			desc:           "top with stdin",
+			arg:            "lsconntrack top --stdin",
+			expectedStatus: exitCodeArgumentsError,
+			expectedSubErr: "top cannot be used with --stdin, --capture or --from-snapshot",
+		},
 	}
 	for _, tc := range tests {
 		outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
@@ -39,3 +131,657 @@ func TestRun_global(t *testing.T) {
 		}
 	}
 }
+
+func TestRun_capture(t *testing.T) {
+	f, err := ioutil.TempFile("", "lsconntrack-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`# addrs
+10.0.0.10
+# listen
+80
+# conntrack
+tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
+`)
+	f.Close()
+
+	outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+	cli := &CLI{outStream: outStream, errStream: errStream}
+	status := cli.Run([]string{"lsconntrack", "-n", "--capture", f.Name()})
+	if status != exitCodeOK {
+		t.Fatalf("status should be %v, not %v: %s", exitCodeOK, status, errStream.String())
+	}
+	if !strings.Contains(outStream.String(), "10.0.2.10:many") {
+		t.Errorf("output should contain the passive flow from 10.0.2.10, got %q", outStream.String())
+	}
+}
+
+func TestRun_fromSnapshot(t *testing.T) {
+	f, err := ioutil.TempFile("", "lsconntrack-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	snap := &snapshot.Snapshot{
+		Version:        snapshot.Version,
+		Hostname:       "web01",
+		LocalAddrs:     []string{"10.0.0.10"},
+		ListeningPorts: []string{"80"},
+		Conntrack:      "tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1\n",
+	}
+	if err := snap.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+	cli := &CLI{outStream: outStream, errStream: errStream}
+	status := cli.Run([]string{"lsconntrack", "-n", "--from-snapshot", f.Name()})
+	if status != exitCodeOK {
+		t.Fatalf("status should be %v, not %v: %s", exitCodeOK, status, errStream.String())
+	}
+	if !strings.Contains(outStream.String(), "10.0.1.10:3306") {
+		t.Errorf("output should contain the active flow to 10.0.1.10:3306, got %q", outStream.String())
+	}
+}
+
+func TestRun_diff(t *testing.T) {
+	older, err := ioutil.TempFile("", "lsconntrack-old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(older.Name())
+	older.WriteString(`[{"direction":"active","local":{"addr":"localhost","port":"many"},"peer":{"addr":"10.0.1.10","port":"3306"},"stat":{"total_inbound_bytes":100,"total_connections":1}}]`)
+	older.Close()
+	newer, err := ioutil.TempFile("", "lsconntrack-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(newer.Name())
+	newer.WriteString(`[{"direction":"active","local":{"addr":"localhost","port":"many"},"peer":{"addr":"10.0.1.10","port":"3306"},"stat":{"total_inbound_bytes":120,"total_connections":1}},
+{"direction":"active","local":{"addr":"localhost","port":"many"},"peer":{"addr":"10.0.1.20","port":"6379"},"stat":{"total_inbound_bytes":10,"total_connections":1}}]`)
+	newer.Close()
+
+	outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+	cli := &CLI{outStream: outStream, errStream: errStream}
+	status := cli.Run([]string{"lsconntrack", "diff", older.Name(), newer.Name()})
+	if status != exitCodeDifferenceFound {
+		t.Fatalf("status should be %v, not %v: %s", exitCodeDifferenceFound, status, errStream.String())
+	}
+	if !strings.Contains(outStream.String(), "10.0.1.20:6379") || strings.Contains(outStream.String(), "10.0.1.10:3306") {
+		t.Errorf("output should contain only the new flow to 10.0.1.20:6379, got %q", outStream.String())
+	}
+
+	status = cli.Run([]string{"lsconntrack", "diff", older.Name(), older.Name()})
+	if status != exitCodeOK {
+		t.Errorf("status should be %v, not %v", exitCodeOK, status)
+	}
+}
+
+func TestRun_check(t *testing.T) {
+	capture, err := ioutil.TempFile("", "lsconntrack-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(capture.Name())
+	capture.WriteString(`# addrs
+10.0.0.10
+# listen
+80
+# conntrack
+tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.1.10 sport=41144 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41144 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
+`)
+	capture.Close()
+	policy, err := ioutil.TempFile("", "lsconntrack-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(policy.Name())
+	policy.WriteString(`{"rules": [{"direction": "active", "peer": "10.0.1.0/24", "port": "3306"}]}`)
+	policy.Close()
+
+	tests := []struct {
+		desc           string
+		format         string
+		expectedSubOut string
+	}{
+		{desc: "table", format: "table", expectedSubOut: "10.0.2.10:many"},
+		{desc: "json", format: "json", expectedSubOut: `"rule":null`},
+		{desc: "junit", format: "junit", expectedSubOut: `<failure message="no rule allows localhost:80 &lt;-- 10.0.2.10:many">`},
+	}
+	for _, tc := range tests {
+		outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+		cli := &CLI{outStream: outStream, errStream: errStream}
+		status := cli.Run([]string{"lsconntrack", "check", "--policy", policy.Name(), "--format", tc.format, "--capture", capture.Name()})
+		if status != exitCodePolicyViolation {
+			t.Errorf("desc: %q, status should be %v, not %v: %s", tc.desc, exitCodePolicyViolation, status, errStream.String())
+		}
+		if !strings.Contains(outStream.String(), tc.expectedSubOut) {
+			t.Errorf("desc: %q, output should contain %q, got %q", tc.desc, tc.expectedSubOut, outStream.String())
+		}
+		if strings.Contains(outStream.String(), "3306 ") {
+			t.Errorf("desc: %q, output should not contain the allowed flow, got %q", tc.desc, outStream.String())
+		}
+	}
+}
+
+func TestRun_genRules(t *testing.T) {
+	f, err := ioutil.TempFile("", "lsconntrack-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`# addrs
+10.0.0.10
+# listen
+80
+# conntrack
+tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 5 CLOSE src=10.0.2.11 dst=10.0.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.11 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
+`)
+	f.Close()
+
+	outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+	cli := &CLI{outStream: outStream, errStream: errStream}
+	status := cli.Run([]string{"lsconntrack", "gen-rules", "--format", "ufw", "--capture", f.Name()})
+	if status != exitCodeOK {
+		t.Fatalf("status should be %v, not %v: %s", exitCodeOK, status, errStream.String())
+	}
+	expected := "ufw allow in proto tcp from 10.0.2.10/31 to any port 80\n"
+	if outStream.String() != expected {
+		t.Errorf("output should be %q, not %q", expected, outStream.String())
+	}
+}
+
+func TestRun_merge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsconntrack-merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/web01.json", []byte(`[{"direction":"active","local":{"addr":"localhost","port":"many"},"peer":{"addr":"db01","port":"3306"},"stat":{"total_inbound_bytes":100,"total_connections":1}}]`), 0644)
+	ioutil.WriteFile(dir+"/db.json", []byte(`[{"host":"db01","direction":"passive","local":{"addr":"localhost","port":"3306"},"peer":{"addr":"web01","port":"many"},"stat":{"total_outbound_bytes":100,"total_connections":1}}]`), 0644)
+
+	outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+	cli := &CLI{outStream: outStream, errStream: errStream}
+	status := cli.Run([]string{"lsconntrack", "merge", "--format", "csv", dir})
+	if status != exitCodeOK {
+		t.Fatalf("status should be %v, not %v: %s", exitCodeOK, status, errStream.String())
+	}
+	expected := "client,server,port,direction,bytes,packets,connections\nweb01,db01,3306,active,100,0,1\n"
+	if outStream.String() != expected {
+		t.Errorf("output should be %q, not %q", expected, outStream.String())
+	}
+}
+
+func TestRun_mergeNumeric(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsconntrack-merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a connection from app01 to db01:3306 tracked on both hosts.
+	captures := map[string]string{
+		"app01": `# addrs
+10.0.0.10
+# listen
+# conntrack
+tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=1 bytes=60 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=100 [ASSURED] mark=0 secmark=0 use=1
+`,
+		"db01": `# addrs
+10.0.1.10
+# listen
+3306
+# conntrack
+tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=1 bytes=60 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=100 [ASSURED] mark=0 secmark=0 use=1
+`,
+	}
+	for host, capture := range captures {
+		path := filepath.Join(dir, host+".capture")
+		if err := ioutil.WriteFile(path, []byte(capture), 0644); err != nil {
+			t.Fatal(err)
+		}
+		outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+		cli := &CLI{outStream: outStream, errStream: errStream}
+		if status := cli.Run([]string{"lsconntrack", "-n", "--json", "--hostname", host, "--capture", path}); status != exitCodeOK {
+			t.Fatalf("status should be %v, not %v: %s", exitCodeOK, status, errStream.String())
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, host+".json"), outStream.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+	cli := &CLI{outStream: outStream, errStream: errStream}
+	status := cli.Run([]string{"lsconntrack", "merge", "--format", "csv", dir})
+	if status != exitCodeOK {
+		t.Fatalf("status should be %v, not %v: %s", exitCodeOK, status, errStream.String())
+	}
+	expected := "client,server,port,direction,bytes,packets,connections\napp01,db01,3306,active,160,2,1\n"
+	if outStream.String() != expected {
+		t.Errorf("output should be %q, not %q", expected, outStream.String())
+	}
+}
+
+func TestRun_jsonEnvelope(t *testing.T) {
+	f, err := ioutil.TempFile("", "lsconntrack-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`# addrs
+10.0.0.10
+# listen
+80
+# conntrack
+tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 5 CLOSE src=10.0.2.10 [ASSURED]
+`)
+	f.Close()
+
+	outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+	cli := &CLI{outStream: outStream, errStream: errStream}
+	status := cli.Run([]string{"lsconntrack", "-n", "--hostname", "web01", "--json-envelope", "--capture", f.Name()})
+	if status != exitCodeOK {
+		t.Fatalf("status should be %v, not %v: %s", exitCodeOK, status, errStream.String())
+	}
+	for _, s := range []string{`"host":"web01"`, `"addrs":["10.0.0.10"]`, `"source":"capture:` + f.Name() + `"`, `"parse_errors":1`, `"version":"` + version + `"`, `"flows":[{"host":"web01"`} {
+		if !strings.Contains(outStream.String(), s) {
+			t.Errorf("output should contain %q, got %q", s, outStream.String())
+		}
+	}
+}
+
+func TestPrintHostFlowsAsNDJSON(t *testing.T) {
+	flows := conntrack.HostFlows{
+		"2-localhost:many-10.0.1.10:3306": {
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "3306"},
+			Stat:      &conntrack.HostFlowStat{},
+		},
+		"4-localhost:80-10.0.2.10:many": {
+			Direction: conntrack.FlowPassive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "80"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.2.10", Port: "many"},
+			Stat:      &conntrack.HostFlowStat{},
+		},
+	}
+	outStream := new(bytes.Buffer)
+	cli := &CLI{outStream: outStream, errStream: new(bytes.Buffer)}
+
+	at := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := cli.PrintHostFlowsAsNDJSON(&tick{seq: 3, at: at}, flows, nil, conntrack.FlowActive|conntrack.FlowPassive); err != nil {
+		t.Fatalf("PrintHostFlowsAsNDJSON should not return error: %v", err)
+	}
+	lines := strings.Split(outStream.String(), "\n")
+	if len(lines) != 3 || lines[2] != "" {
+		t.Fatalf("output should be 2 lines ended with newline, got %q", outStream.String())
+	}
+	if !strings.HasPrefix(lines[0], `{"seq":3,"timestamp":"2018-01-01T00:00:00Z","direction":"active",`) {
+		t.Errorf("line should carry the tick, got %q", lines[0])
+	}
+
+	outStream.Reset()
+	if err := cli.PrintHostFlowsAsJSON(flows, nil, conntrack.FlowActive); err != nil {
+		t.Fatalf("PrintHostFlowsAsJSON should not return error: %v", err)
+	}
+	if len(flows) != 2 {
+		t.Errorf("PrintHostFlowsAsJSON should not delete the flows of the caller, got %d flows", len(flows))
+	}
+	if !strings.HasSuffix(outStream.String(), "]\n") || strings.Contains(outStream.String(), "passive") {
+		t.Errorf("output should be the active flows ended with newline, got %q", outStream.String())
+	}
+}
+
+func TestRun_csv(t *testing.T) {
+	f, err := ioutil.TempFile("", "lsconntrack-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`# addrs
+10.0.0.10
+# listen
+80
+# conntrack
+tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
+`)
+	f.Close()
+
+	tests := []struct {
+		desc     string
+		args     []string
+		expected string
+	}{
+		{
+			desc:     "csv",
+			args:     []string{"--format", "csv", "--columns", "direction,peer_addr,in_bytes,conns"},
+			expected: "direction,peer_addr,in_bytes,conns\npassive,10.0.2.10,164,1\n",
+		},
+		{
+			desc:     "tsv without header",
+			args:     []string{"--format", "tsv", "--no-header", "--columns", "local_port,out_bytes"},
+			expected: "80\t60\n",
+		},
+	}
+	for _, tc := range tests {
+		outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+		cli := &CLI{outStream: outStream, errStream: errStream}
+		args := append([]string{"lsconntrack", "-n", "--capture", f.Name()}, tc.args...)
+		if status := cli.Run(args); status != exitCodeOK {
+			t.Fatalf("desc: %q, status should be %v, not %v: %s", tc.desc, exitCodeOK, status, errStream.String())
+		}
+		if outStream.String() != tc.expected {
+			t.Errorf("desc: %q, output should be %q, not %q", tc.desc, tc.expected, outStream.String())
+		}
+	}
+}
+
+func TestRun_push(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsconntrack-push")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	capture := filepath.Join(dir, "capture")
+	ioutil.WriteFile(capture, []byte(`# addrs
+10.0.0.10
+# listen
+80
+# conntrack
+tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
+`), 0644)
+
+	sock := filepath.Join(dir, "influx.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		b, _ := ioutil.ReadAll(conn)
+		received <- string(b)
+	}()
+
+	tests := []struct {
+		desc     string
+		format   string
+		push     string
+		read     func() string
+		expected string
+	}{
+		{
+			desc:   "influx to unix socket",
+			format: "influx",
+			push:   "unix://" + sock,
+			read: func() string {
+				select {
+				case s := <-received:
+					return s
+				case <-time.After(5 * time.Second):
+					return ""
+				}
+			},
+			expected: "lsconntrack,direction=passive,peer=10.0.2.10,port=80,proto=tcp in_bytes=164i,out_bytes=60i,in_packets=3i,out_packets=1i,connections=1i ",
+		},
+		{
+			desc:   "graphite to file",
+			format: "graphite",
+			push:   filepath.Join(dir, "graphite.txt"),
+			read: func() string {
+				b, _ := ioutil.ReadFile(filepath.Join(dir, "graphite.txt"))
+				return string(b)
+			},
+			expected: "lsconntrack.in_bytes;direction=passive;peer=10.0.2.10;port=80;proto=tcp 164 ",
+		},
+	}
+	for _, tc := range tests {
+		outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+		cli := &CLI{outStream: outStream, errStream: errStream}
+		args := []string{"lsconntrack", "-n", "--capture", capture, "--format", tc.format, "--push", tc.push}
+		if status := cli.Run(args); status != exitCodeOK {
+			t.Fatalf("desc: %q, status should be %v, not %v: %s", tc.desc, exitCodeOK, status, errStream.String())
+		}
+		if outStream.Len() != 0 {
+			t.Errorf("desc: %q, output should be empty, not %q", tc.desc, outStream.String())
+		}
+		if got := tc.read(); !strings.Contains(got, tc.expected) {
+			t.Errorf("desc: %q, pushed points should contain %q, not %q", tc.desc, tc.expected, got)
+		}
+	}
+}
+
+func TestSinks_send(t *testing.T) {
+	// the rounds of a passive flow, whose inbound bytes increase by 100.
+	rounds := []string{
+		"tcp      6 86399 ESTABLISHED src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+		"tcp      6 86399 ESTABLISHED src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80 packets=4 bytes=264 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+	}
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer ts.Close()
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	sk := &sinks{exportTo: ln.LocalAddr().String(), otlpTo: ts.URL}
+	sk.ex, err = ipfix.Dial(sk.exportTo, ipfix.IPFIX, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sk.ex.Close()
+	sk.ot, err = otlp.NewExporter(sk.otlpTo, "0.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// OTLP exports the names, which IPFIX cannot carry.
+	resolve := func(addr string) string {
+		if addr == "10.0.2.10" {
+			return "web-2"
+		}
+		return addr
+	}
+	o := &origin{host: "web-1", addrs: []string{"10.0.0.10"}}
+	at := time.Unix(1500000000, 0)
+	for i, entries := range rounds {
+		flows := conntracktest.Web.Parse(t, entries)
+		sk.send(&tick{seq: i + 1, at: at.Add(time.Duration(i) * time.Minute)}, flows, resolve, conntrack.FlowActive|conntrack.FlowPassive, o)
+	}
+
+	for _, expected := range []string{
+		`{"key":"host.name","value":{"stringValue":"web-1"}}`,
+		`{"key":"peer","value":{"stringValue":"web-2"}}`,
+		`"asInt":"100"`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("the exported metrics should contain %q, got %q", expected, body)
+		}
+	}
+	ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 65535)
+	n, _, err := ln.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("the collector should receive the IPFIX records of the numerical addresses: %v", err)
+	}
+	if !bytes.Contains(buf[:n], net.ParseIP("10.0.2.10").To4()) {
+		t.Errorf("the IPFIX records should carry 10.0.2.10, got %x", buf[:n])
+	}
+}
+
+func TestRun_history(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsconntrack-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "flows.db")
+	db := store.Open(path)
+	now := time.Now()
+	for i, peer := range []string{"10.0.1.10", "10.0.1.11", "10.0.1.10"} {
+		flow := &conntrack.HostFlow{
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: peer, Port: "3306"},
+			Stat:      &conntrack.HostFlowStat{TotalInboundPackets: 1, TotalInboundBytes: int64(100 * (i + 1)), TotalConnections: 1},
+		}
+		// the first record is older than --since.
+		at := now.Add(time.Duration(i-2) * time.Hour)
+		if i == 0 {
+			at = now.Add(-48 * time.Hour)
+		}
+		db.Append(&store.Record{At: at, Host: "app-1", Flows: conntrack.HostFlows{flow.UniqKey(): flow}})
+	}
+
+	tests := []struct {
+		desc        string
+		args        []string
+		expected    []string
+		notExpected []string
+	}{
+		{
+			desc:        "peer",
+			args:        []string{"--peer", "10.0.1.10"},
+			expected:    []string{"app-1", "10.0.1.10:3306", "300"},
+			notExpected: []string{"10.0.1.11", "\t100 "},
+		},
+		{
+			desc:        "cidr",
+			args:        []string{"--peer", "10.0.1.0/24", "--json"},
+			expected:    []string{`"host":"app-1"`, `"addr":"10.0.1.11"`, `"addr":"10.0.1.10"`},
+			notExpected: []string{`"total_inbound_bytes":100,`},
+		},
+		{
+			desc:     "since",
+			args:     []string{"--since", "3d", "--json"},
+			expected: []string{`"total_inbound_bytes":100,`},
+		},
+	}
+	for _, tc := range tests {
+		outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+		cli := &CLI{outStream: outStream, errStream: errStream}
+		args := append([]string{"lsconntrack", "history", "--db", path}, tc.args...)
+		if status := cli.Run(args); status != exitCodeOK {
+			t.Fatalf("desc: %q, status should be %v, not %v: %s", tc.desc, exitCodeOK, status, errStream.String())
+		}
+		for _, expected := range tc.expected {
+			if !strings.Contains(outStream.String(), expected) {
+				t.Errorf("desc: %q, output should contain %q, got %q", tc.desc, expected, outStream.String())
+			}
+		}
+		for _, notExpected := range tc.notExpected {
+			if strings.Contains(outStream.String(), notExpected) {
+				t.Errorf("desc: %q, output should not contain %q, got %q", tc.desc, notExpected, outStream.String())
+			}
+		}
+	}
+}
+
+func TestRun_historyStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsconntrack-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "flows.db")
+	db := store.Open(path)
+	tracker := conntrack.NewTracker()
+	now := time.Now()
+	for _, r := range []struct {
+		peer string
+		ago  time.Duration
+	}{
+		{"10.0.1.10", 10 * 24 * time.Hour},
+		{"10.0.1.11", 9 * 24 * time.Hour},
+		{"10.0.1.10", time.Hour},
+	} {
+		flow := &conntrack.HostFlow{
+			Host:      "app-1",
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: r.peer, Port: "3306"},
+			Stat:      &conntrack.HostFlowStat{TotalInboundPackets: 1, TotalInboundBytes: 100, TotalConnections: 1},
+		}
+		// the flows are recorded with when they are seen as the recorder does.
+		flows := conntrack.HostFlows{flow.UniqKey(): flow}
+		tracker.Observe(flows, now.Add(-r.ago))
+		if err := db.Append(&store.Record{At: now.Add(-r.ago), Host: "app-1", Flows: flows}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the records older than the default retention are removed, but when the flows are seen are kept.
+	if err := db.Compact(now, store.Policy{Retention: 7 * 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+	cli := &CLI{outStream: outStream, errStream: errStream}
+	if status := cli.Run([]string{"lsconntrack", "history", "--db", path, "--stale", "7d"}); status != exitCodeOK {
+		t.Fatalf("status should be %v, not %v: %s", exitCodeOK, status, errStream.String())
+	}
+	lines := strings.Split(strings.TrimSpace(outStream.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("the stale flows should be 1, got %q", outStream.String())
+	}
+	if !strings.Contains(lines[1], "10.0.1.11:3306") || !strings.Contains(lines[1], "app-1") {
+		t.Errorf("the stale flow should be app-1 --> 10.0.1.11:3306, got %q", lines[1])
+	}
+}
+
+func TestEntriesOf(t *testing.T) {
+	f, err := ioutil.TempFile("", "lsconntrack-conntrack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=1 bytes=60 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=100 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.11 sport=41144 dport=6379 packets=1 bytes=60 src=10.0.1.11 dst=10.0.0.10 sport=6379 dport=41144 packets=1 bytes=100 [ASSURED] mark=0 secmark=0 use=1
+`)
+	f.Close()
+	flow := &conntrack.HostFlow{
+		Direction: conntrack.FlowActive,
+		Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+		Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "3306"},
+		Stat:      &conntrack.HostFlowStat{},
+	}
+	tests := []struct {
+		desc           string
+		source         string
+		expected       int
+		expectedSubErr string
+	}{
+		{desc: "conntrack file", source: f.Name(), expected: 1},
+		{desc: "stdin", source: "stdin", expectedSubErr: "the entries are not available for stdin"},
+	}
+	for _, tc := range tests {
+		cl := &collector{origin: origin{source: tc.source}}
+		entries, err := entriesOf(cl, flow)
+		if tc.expectedSubErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.expectedSubErr) {
+				t.Errorf("desc: %q, should raise error %q, not %v", tc.desc, tc.expectedSubErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("desc: %q, should not raise error: %v", tc.desc, err)
+		}
+		if len(entries) != tc.expected {
+			t.Errorf("desc: %q, the entries should be %d, not %q", tc.desc, tc.expected, entries)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/netutil"
+	"github.com/yuuki/lsconntrack/top"
+)
+
+// runTop shows the host flows in the full-screen terminal UI refreshing every interval.
+func (c *CLI) runTop(args []string) int {
+	var (
+		cl       collector
+		interval time.Duration
+	)
+	flags := flag.NewFlagSet("lsconntrack top", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+	flags.Usage = func() {
+		fmt.Fprint(c.errStream, helpText)
+	}
+	cl.setFlags(flags)
+	flags.DurationVar(&interval, "interval", time.Second, "")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeFlagParseError
+	}
+	if interval <= 0 {
+		log.Println("--interval should be positive")
+		return exitCodeArgumentsError
+	}
+	if cl.stdin || cl.captureFile != "" || cl.snapshotFile != "" {
+		log.Println("top cannot be used with --stdin, --capture or --from-snapshot")
+		return exitCodeArgumentsError
+	}
+
+	term, err := top.OpenTerminal(int(os.Stdin.Fd()))
+	if err != nil {
+		log.Printf("top requires a terminal: %v\n", err)
+		return exitCodeArgumentsError
+	}
+	fmt.Fprint(c.outStream, top.EnterScreen)
+	defer func() {
+		fmt.Fprint(c.outStream, top.LeaveScreen)
+		term.Restore()
+	}()
+	// the terminal are restored on the signals as well, such as the session closed.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	keys, done := make(chan string), make(chan struct{})
+	go term.ReadKeys(keys, done)
+	// the keys are no longer read before the terminal are restored.
+	defer func() {
+		close(done)
+		for range keys {
+		}
+	}()
+
+	m := top.NewModel()
+	draw := func() {
+		width, height, err := term.Size()
+		if err != nil || width == 0 || height == 0 {
+			width, height = 80, 24
+		}
+		m.Render(c.outStream, width, height)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// the names are resolved for display, and the flows are kept numerical to drill down.
+		flows, resolve, status := cl.collect()
+		if status != exitCodeOK {
+			return status
+		}
+		m.Update(flows.Filter(cl.mode()), resolve, cl.origin.collectedAt)
+		draw()
+	wait:
+		for {
+			select {
+			case <-ticker.C:
+				break wait
+			case <-sigs:
+				return exitCodeOK
+			case k, ok := <-keys:
+				if !ok {
+					return exitCodeOK
+				}
+				switch m.Key(k) {
+				case top.ActionQuit:
+					return exitCodeOK
+				case top.ActionDrillDown:
+					m.ShowEntries(entriesOf(&cl, m.Selected().Flow))
+				}
+				draw()
+			}
+		}
+	}
+}
+
+// entriesOf returns the conntrack entries of the flow read from the source of cl,
+// which is the conntrack file of the host network namespace, or of the network namespace
+// of the flow entered again for --netns and --all-netns.
+func entriesOf(cl *collector, flow *conntrack.HostFlow) ([]string, error) {
+	source := cl.origin.source
+	var nsPath string
+	switch {
+	case strings.HasPrefix(source, "/"):
+		return readEntries(source, flow)
+	case strings.HasPrefix(source, "netns:"):
+		var err error
+		nsPath, err = netutil.NetnsPath(cl.netns)
+		if err != nil {
+			return nil, err
+		}
+	case source == "all-netns":
+		nslist, err := netutil.NetnsList()
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nslist {
+			if ns.Name == flow.Netns {
+				nsPath = ns.Path
+			}
+		}
+		if nsPath == "" {
+			return nil, fmt.Errorf("not found network namespace %s", flow.Netns)
+		}
+	default:
+		return nil, fmt.Errorf("the entries are not available for %s", source)
+	}
+	var entries []string
+	err := netutil.RunInNetns(nsPath, func() error {
+		path := netutil.FindConntrackPathIn(netutil.ThreadProcNetPath())
+		if path == "" {
+			return fmt.Errorf("not found conntrack entries path in %s", nsPath)
+		}
+		var err error
+		entries, err = readEntries(path, flow)
+		return err
+	})
+	return entries, err
+}
+
+// readEntries returns the conntrack entries of the flow in the conntrack file at path.
+func readEntries(path string, flow *conntrack.HostFlow) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return conntrack.Entries(f, flow)
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/kubernetes"
+	"github.com/yuuki/lsconntrack/netutil"
+	"github.com/yuuki/lsconntrack/snapshot"
+)
+
+type portslice []string
+
+func (s *portslice) String() string {
+	return fmt.Sprintf("%s", *s)
+}
+
+func (s *portslice) Set(value string) error {
+	if _, err := strconv.Atoi(value); err != nil {
+		return fmt.Errorf("%s is not number", value)
+	}
+	*s = append(*s, value)
+	return nil
+}
+
+type cidrslice []*net.IPNet
+
+func (s *cidrslice) String() string {
+	return fmt.Sprintf("%s", *s)
+}
+
+func (s *cidrslice) Set(value string) error {
+	_, ipnet, err := net.ParseCIDR(value)
+	if err != nil {
+		return fmt.Errorf("%s is not CIDR", value)
+	}
+	*s = append(*s, ipnet)
+	return nil
+}
+
+type addrslice []string
+
+func (s *addrslice) String() string {
+	return fmt.Sprintf("%s", *s)
+}
+
+func (s *addrslice) Set(value string) error {
+	if _, err := conntrack.NewLocalAddrs([]string{value}); err != nil {
+		return fmt.Errorf("%s is neither IP address nor CIDR", value)
+	}
+	*s = append(*s, value)
+	return nil
+}
+
+// origin are where and when the host flows are collected.
+type origin struct {
+	host        string
+	addrs       []string
+	collectedAt time.Time
+	kernel      string
+	source      string
+	parseErrors int
+}
+
+// collector collects the host flows by the options shared among the commands.
+type collector struct {
+	active, passive           bool
+	activePorts, passivePorts portslice
+	forwarded, byServer       bool
+	clientCIDRs               cidrslice
+	numeric                   bool
+	owner                     bool
+	k8sState                  string
+	netns                     string
+	allNetns                  bool
+	localAddrs                addrslice
+	listenPortsFile           string
+	captureFile               string
+	snapshotFile              string
+	ephemeralPorts            string
+	hostname                  string
+	stdin                     bool
+
+	// origin are set by collect.
+	origin origin
+}
+
+// setFlags defines the options on flags.
+func (cl *collector) setFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&cl.active, "a", false, "")
+	flags.BoolVar(&cl.active, "active", false, "")
+	flags.BoolVar(&cl.passive, "p", false, "")
+	flags.BoolVar(&cl.passive, "passive", false, "")
+	flags.Var(&cl.activePorts, "aport", "")
+	flags.Var(&cl.activePorts, "active-port", "")
+	flags.Var(&cl.passivePorts, "pport", "")
+	flags.Var(&cl.passivePorts, "passive-port", "")
+	flags.BoolVar(&cl.forwarded, "forwarded", false, "")
+	flags.Var(&cl.clientCIDRs, "client-cidr", "")
+	flags.BoolVar(&cl.byServer, "by-server", false, "")
+	flags.BoolVar(&cl.numeric, "n", false, "")
+	flags.BoolVar(&cl.numeric, "numeric", false, "")
+	flags.BoolVar(&cl.owner, "owner", false, "")
+	flags.StringVar(&cl.k8sState, "k8s-state", "", "")
+	flags.StringVar(&cl.netns, "netns", "", "")
+	flags.BoolVar(&cl.allNetns, "all-netns", false, "")
+	flags.Var(&cl.localAddrs, "local-addr", "")
+	flags.StringVar(&cl.listenPortsFile, "listen-ports-file", "", "")
+	flags.StringVar(&cl.captureFile, "capture", "", "")
+	flags.StringVar(&cl.snapshotFile, "from-snapshot", "", "")
+	flags.StringVar(&cl.ephemeralPorts, "ephemeral-ports", "", "")
+	flags.StringVar(&cl.hostname, "hostname", "", "")
+	flags.BoolVar(&cl.stdin, "stdin", false, "")
+}
+
+// mode returns the directions of the host flows to print.
+func (cl *collector) mode() conntrack.FlowDirection {
+	if cl.forwarded {
+		return conntrack.FlowForwarded
+	}
+	var mode conntrack.FlowDirection
+	if cl.active {
+		mode |= conntrack.FlowActive
+	}
+	if cl.passive {
+		mode |= conntrack.FlowPassive
+	}
+	if !cl.active && !cl.passive {
+		mode = conntrack.FlowActive | conntrack.FlowPassive
+	}
+	return mode
+}
+
+// collect collects the host flows and returns them with the function to
+// resolve the addresses into names, which is nil on --numeric.
+// It returns the exit code on failure.
+func (cl *collector) collect() (conntrack.HostFlows, func(string) string, int) {
+	if cl.forwarded && (cl.active || cl.passive) {
+		log.Println("--forwarded cannot be used with --active or --passive")
+		return nil, nil, exitCodeArgumentsError
+	}
+	if cl.stdin && (cl.netns != "" || cl.allNetns) {
+		log.Println("--stdin cannot be used with --netns or --all-netns")
+		return nil, nil, exitCodeArgumentsError
+	}
+	if cl.captureFile != "" && (cl.stdin || cl.netns != "" || cl.allNetns) {
+		log.Println("--capture cannot be used with --stdin, --netns or --all-netns")
+		return nil, nil, exitCodeArgumentsError
+	}
+	if cl.snapshotFile != "" && (cl.captureFile != "" || cl.stdin || cl.netns != "" || cl.allNetns) {
+		log.Println("--from-snapshot cannot be used with --capture, --stdin, --netns or --all-netns")
+		return nil, nil, exitCodeArgumentsError
+	}
+	mode := cl.mode()
+
+	// The local addresses and the listening ports of this host are not used
+	// in the offline analysis of the conntrack entries from another host.
+	var (
+		local        conntrack.LocalAddrs
+		capture      *conntrack.Capture
+		ephemeral    *netutil.PortRange
+		localAddrs   = append([]string{}, cl.localAddrs...)
+		passivePorts = cl.passivePorts
+		hostname     = cl.hostname
+		kernel       string
+		collectedAt  = time.Now().UTC()
+		offline      = len(cl.localAddrs) > 0 || cl.captureFile != "" || cl.snapshotFile != ""
+	)
+	if cl.ephemeralPorts != "" {
+		var err error
+		ephemeral, err = netutil.ParsePortRange(cl.ephemeralPorts)
+		if err != nil {
+			log.Println(err)
+			return nil, nil, exitCodeArgumentsError
+		}
+	}
+	if cl.captureFile != "" {
+		f, err := os.Open(cl.captureFile)
+		if err != nil {
+			log.Printf("failed to open %v: %v\n", cl.captureFile, err)
+			return nil, nil, exitCodeArgumentsError
+		}
+		capture, err = conntrack.ReadCapture(f)
+		f.Close()
+		if err != nil {
+			log.Printf("failed to read %v: %v\n", cl.captureFile, err)
+			return nil, nil, exitCodeArgumentsError
+		}
+	}
+	if cl.snapshotFile != "" {
+		snap, err := snapshot.ReadFile(cl.snapshotFile)
+		if err != nil {
+			log.Printf("failed to read %v: %v\n", cl.snapshotFile, err)
+			return nil, nil, exitCodeArgumentsError
+		}
+		capture = snap.Capture()
+		if hostname == "" {
+			hostname = snap.Hostname
+		}
+		kernel, collectedAt = snap.Kernel, snap.Timestamp
+		if ephemeral == nil {
+			ephemeral = snap.EphemeralPortRange
+		}
+	}
+	if capture != nil {
+		localAddrs = append(localAddrs, capture.LocalAddrs...)
+		if len(passivePorts) == 0 {
+			passivePorts = capture.ListeningPorts
+		}
+	}
+	if len(localAddrs) > 0 {
+		var err error
+		local, err = conntrack.NewLocalAddrs(localAddrs)
+		if err != nil {
+			log.Println(err)
+			return nil, nil, exitCodeArgumentsError
+		}
+	}
+	if cl.listenPortsFile != "" && len(passivePorts) == 0 {
+		f, err := os.Open(cl.listenPortsFile)
+		if err != nil {
+			log.Printf("failed to open %v: %v\n", cl.listenPortsFile, err)
+			return nil, nil, exitCodeArgumentsError
+		}
+		passivePorts, err = netutil.ParseListeningPorts(f)
+		f.Close()
+		if err != nil {
+			log.Printf("failed to read %v: %v\n", cl.listenPortsFile, err)
+			return nil, nil, exitCodeArgumentsError
+		}
+		offline = true
+	}
+
+	var (
+		owners         *conntrack.Owners
+		containerPorts []string
+	)
+	if cl.owner {
+		addrs, ports, err := netutil.ContainerOwners()
+		if err != nil {
+			log.Printf("failed to get container addresses: %v\n", err)
+			return nil, nil, exitCodeParseConntrackError
+		}
+		sockets, err := netutil.SocketOwners()
+		if err != nil {
+			log.Printf("failed to get socket owners: %v\n", err)
+			return nil, nil, exitCodeParseConntrackError
+		}
+		owners = &conntrack.Owners{Addrs: addrs, Sockets: sockets}
+		containerPorts = ports
+	}
+
+	var names *kubernetes.Names
+	if cl.k8sState != "" {
+		names = kubernetes.NewNames()
+		f, err := os.Open(cl.k8sState)
+		if err != nil {
+			log.Printf("failed to open %v: %v\n", cl.k8sState, err)
+			return nil, nil, exitCodeArgumentsError
+		}
+		err = names.Load(f)
+		f.Close()
+		if err != nil {
+			log.Println(err)
+			return nil, nil, exitCodeArgumentsError
+		}
+		if owners != nil {
+			for addr := range owners.Addrs {
+				if name := names.Lookup(addr); name != "" {
+					owners.Addrs[addr] = name
+				}
+			}
+		}
+	}
+
+	// The direction is guessed by the ephemeral port range only if the listening ports are not given explicitly.
+	fports := conntrack.FilterPorts{
+		Active:  cl.activePorts,
+		Passive: passivePorts,
+	}
+	if len(cl.passivePorts) == 0 {
+		fports.Ephemeral = ephemeral
+	}
+	var parseErrors int
+	parse := func(r io.Reader, fports conntrack.FilterPorts) (conntrack.HostFlows, error) {
+		var (
+			flows     conntrack.HostFlows
+			malformed int
+			err       error
+		)
+		if cl.forwarded {
+			flows, malformed, err = conntrack.ParseForwardedEntries(r, local, &conntrack.ForwardedOptions{
+				ServerPorts: fports.Active,
+				ClientCIDRs: cl.clientCIDRs,
+				ByServer:    cl.byServer,
+			})
+		} else {
+			flows, malformed, err = conntrack.ParseEntries(r, local, fports, owners)
+		}
+		parseErrors += malformed
+		return flows, err
+	}
+	var (
+		flows  conntrack.HostFlows
+		source string
+	)
+	if cl.netns != "" || cl.allNetns {
+		var nslist []netutil.Netns
+		if cl.allNetns {
+			source = "all-netns"
+			var err error
+			nslist, err = netutil.NetnsList()
+			if err != nil {
+				log.Printf("failed to get network namespaces: %v\n", err)
+				return nil, nil, exitCodeParseConntrackError
+			}
+		} else {
+			path, err := netutil.NetnsPath(cl.netns)
+			if err != nil {
+				log.Println(err)
+				return nil, nil, exitCodeArgumentsError
+			}
+			nslist = []netutil.Netns{{Name: cl.netns, Path: path}}
+			source = "netns:" + cl.netns
+		}
+		flows = conntrack.HostFlows{}
+		for _, ns := range nslist {
+			var nsflows conntrack.HostFlows
+			err := netutil.RunInNetns(ns.Path, func() error {
+				var err error
+				nsflows, err = readHostFlows(netutil.ThreadProcNetPath(), mode, fports, containerPorts, parse)
+				return err
+			})
+			if err != nil {
+				if cl.allNetns {
+					log.Printf("skip network namespace %s: %v\n", ns.Name, err)
+					continue
+				}
+				log.Println(err)
+				return nil, nil, exitCodeParseConntrackError
+			}
+			if cl.allNetns {
+				for _, flow := range nsflows {
+					flow.Netns = ns.Name
+				}
+			}
+			flows.Merge(nsflows)
+		}
+	} else {
+		var r io.Reader
+		if capture != nil {
+			r = bytes.NewReader(capture.Entries)
+			source = "capture:" + cl.captureFile
+			if cl.snapshotFile != "" {
+				source = "snapshot:" + cl.snapshotFile
+			}
+		} else if cl.stdin {
+			r = os.Stdin
+			source = "stdin"
+		} else {
+			path := netutil.FindConntrackPath()
+			if path == "" {
+				log.Println("not found conntrack entries path: Please load conntrack module")
+				return nil, nil, exitCodeParseConntrackError
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				log.Printf("failed to open %v: %v\n", path, err)
+				return nil, nil, exitCodeParseConntrackError
+			}
+			defer f.Close()
+			r = f
+			source = path
+		}
+
+		if mode&conntrack.FlowPassive != 0 && len(fports.Passive) == 0 && !offline {
+			var err error
+			fports.Passive, err = netutil.LocalListeningPorts()
+			if err != nil {
+				log.Printf("failed to get local listening ports: %v\n", err)
+				return nil, nil, exitCodeParseConntrackError
+			}
+			fports.Passive = append(fports.Passive, containerPorts...)
+			if fports.Ephemeral == nil {
+				// the range are optional since it is only a hint for the direction.
+				fports.Ephemeral, _ = netutil.EphemeralPortRange()
+			}
+		}
+
+		var err error
+		flows, err = parse(r, fports)
+		if err != nil {
+			log.Println(err)
+			return nil, nil, exitCodeParseConntrackError
+		}
+	}
+
+	if hostname == "" && !offline && !cl.stdin {
+		var err error
+		hostname, err = os.Hostname()
+		if err != nil {
+			log.Printf("failed to get hostname: %v\n", err)
+			return nil, nil, exitCodeParseConntrackError
+		}
+	}
+	for _, flow := range flows {
+		flow.Host = hostname
+	}
+	if kernel == "" && !offline && !cl.stdin {
+		// the kernel are only informative.
+		kernel, _ = netutil.KernelRelease()
+	}
+	if len(localAddrs) == 0 && !cl.stdin {
+		localAddrs, _ = netutil.LocalIPAddrs()
+	}
+	cl.origin = origin{
+		host:        hostname,
+		addrs:       localAddrs,
+		collectedAt: collectedAt,
+		kernel:      kernel,
+		source:      source,
+		parseErrors: parseErrors,
+	}
+
+	var resolve func(string) string
+	if !cl.numeric {
+		resolve = netutil.ResolveAddr
+	}
+	if names != nil {
+		names.LearnClusterIPs(flows)
+		resolve = names.Resolver(resolve)
+	}
+	return flows, resolve, exitCodeOK
+}
+
+// envelope envelops the flows with the origin set by collect.
+func (cl *collector) envelope(flows conntrack.HostFlows) *conntrack.Envelope {
+	return &conntrack.Envelope{
+		Host:        cl.origin.host,
+		Addrs:       cl.origin.addrs,
+		CollectedAt: cl.origin.collectedAt,
+		Kernel:      cl.origin.kernel,
+		Version:     version,
+		Source:      cl.origin.source,
+		ParseErrors: cl.origin.parseErrors,
+		Flows:       flows,
+	}
+}
+
+// readHostFlows reads the conntrack entries through the procfs net directory
+// such as '/proc/thread-self/net' and aggregates them into host flows.
+// The ports listened in the directory and containerPorts are used for passive flows if fports.Passive is empty.
+func readHostFlows(procNet string, mode conntrack.FlowDirection, fports conntrack.FilterPorts, containerPorts []string, parse func(io.Reader, conntrack.FilterPorts) (conntrack.HostFlows, error)) (conntrack.HostFlows, error) {
+	path := netutil.FindConntrackPathIn(procNet)
+	if path == "" {
+		return nil, fmt.Errorf("not found conntrack entries path in %s: Please load conntrack module", procNet)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %v: %v", path, err)
+	}
+	defer f.Close()
+
+	if mode&conntrack.FlowPassive != 0 && len(fports.Passive) == 0 {
+		fports.Passive, err = netutil.ListeningPortsIn(procNet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get local listening ports: %v", err)
+		}
+		fports.Passive = append(fports.Passive, containerPorts...)
+		if fports.Ephemeral == nil {
+			// the range of the network namespace entered by the calling thread.
+			fports.Ephemeral, _ = netutil.EphemeralPortRange()
+		}
+	}
+	return parse(f, fports)
+}
@@ -0,0 +1,86 @@
+package conntrack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yuuki/lsconntrack/netutil"
+)
+
+// Capture represents a conntrack dump bundled with the local addresses and the
+// listening ports of the origin host, so that it can be analysed on any host.
+// The sections are the addresses or CIDRs separated by white spaces, the listening
+// ports in the format of ParseListeningPorts and the conntrack entries.
+// -----------------------------------------------------------------------------------
+// # addrs
+// 10.0.0.10 172.17.0.1
+// # listen
+// State      Recv-Q Send-Q Local Address:Port               Peer Address:Port
+// LISTEN     0      128               *:22                            *:*
+// # conntrack
+// tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.0.11 sport=41143 dport=443 ...
+type Capture struct {
+	LocalAddrs     []string
+	ListeningPorts []string
+	Entries        []byte
+}
+
+// Capture sections.
+const (
+	captureAddrs     = "# addrs"
+	captureListen    = "# listen"
+	captureConntrack = "# conntrack"
+)
+
+// ReadCapture reads the capture format.
+func ReadCapture(r io.Reader) (*Capture, error) {
+	var (
+		section          string
+		listen, entries  bytes.Buffer
+		addrs            []string
+		sectionsIncluded = map[string]bool{}
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch strings.TrimSpace(line) {
+		case captureAddrs, captureListen, captureConntrack:
+			section = strings.TrimSpace(line)
+			sectionsIncluded[section] = true
+			continue
+		}
+		switch section {
+		case captureAddrs:
+			addrs = append(addrs, strings.Fields(line)...)
+		case captureListen:
+			fmt.Fprintln(&listen, line)
+		case captureConntrack:
+			fmt.Fprintln(&entries, line)
+		default:
+			return nil, fmt.Errorf("unexpected line out of sections: %s", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, section := range []string{captureAddrs, captureListen, captureConntrack} {
+		if !sectionsIncluded[section] {
+			return nil, fmt.Errorf("not found %q section in the capture", section)
+		}
+	}
+	if _, err := NewLocalAddrs(addrs); err != nil {
+		return nil, err
+	}
+	ports, err := netutil.ParseListeningPorts(&listen)
+	if err != nil {
+		return nil, err
+	}
+	return &Capture{
+		LocalAddrs:     addrs,
+		ListeningPorts: ports,
+		Entries:        entries.Bytes(),
+	}, nil
+}
@@ -0,0 +1,45 @@
+package conntrack
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCapture(t *testing.T) {
+	in := `# addrs
+10.0.0.10 172.17.0.0/16
+# listen
+State      Recv-Q Send-Q Local Address:Port               Peer Address:Port
+LISTEN     0      128               *:80                            *:*
+# conntrack
+tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 5 CLOSE src=172.17.0.2 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=172.17.0.2 sport=3306 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
+`
+	capture, err := ReadCapture(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if !reflect.DeepEqual(capture.LocalAddrs, []string{"10.0.0.10", "172.17.0.0/16"}) {
+		t.Errorf("LocalAddrs should be [10.0.0.10 172.17.0.0/16], not %v", capture.LocalAddrs)
+	}
+	if !reflect.DeepEqual(capture.ListeningPorts, []string{"80"}) {
+		t.Errorf("ListeningPorts should be [80], not %v", capture.ListeningPorts)
+	}
+
+	local, _ := NewLocalAddrs(capture.LocalAddrs)
+	flows, _, err := ParseEntries(bytes.NewReader(capture.Entries), local, FilterPorts{Passive: capture.ListeningPorts}, nil)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	for _, key := range []string{"4-localhost:80-10.0.2.10:many", "2-localhost:many-10.0.1.10:3306"} {
+		if _, ok := flows[key]; !ok {
+			t.Errorf("flows should contain %q, got %v", key, flows)
+		}
+	}
+
+	if _, err := ReadCapture(strings.NewReader("tcp 6 5 CLOSE\n")); err == nil {
+		t.Error("should raise error on the line out of sections")
+	}
+}
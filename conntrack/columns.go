@@ -0,0 +1,98 @@
+package conntrack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column are a field of HostFlow printed in the tabular formats such as CSV.
+type Column struct {
+	Name  string
+	Value func(f *HostFlow) string
+}
+
+func int64Column(name string, value func(s *HostFlowStat) int64) *Column {
+	return &Column{Name: name, Value: func(f *HostFlow) string {
+		return strconv.FormatInt(value(f.Stat), 10)
+	}}
+}
+
+// seenColumn returns the column of Seen, which is empty if the flow is not tracked.
+func seenColumn(name string, value func(s *Seen) string) *Column {
+	return &Column{Name: name, Value: func(f *HostFlow) string {
+		if f.Seen == nil {
+			return ""
+		}
+		return value(f.Seen)
+	}}
+}
+
+// Columns are all the columns of HostFlow.
+var Columns = []*Column{
+	{Name: "host", Value: func(f *HostFlow) string { return f.Host }},
+	{Name: "netns", Value: func(f *HostFlow) string { return f.Netns }},
+	{Name: "direction", Value: func(f *HostFlow) string { return f.Direction.String() }},
+	{Name: "direction_reason", Value: func(f *HostFlow) string { return f.Reason.String() }},
+	{Name: "local_addr", Value: func(f *HostFlow) string { return f.Local.Addr }},
+	{Name: "local_port", Value: func(f *HostFlow) string { return f.Local.Port }},
+	{Name: "peer_addr", Value: func(f *HostFlow) string { return f.Peer.Addr }},
+	{Name: "peer_port", Value: func(f *HostFlow) string { return f.Peer.Port }},
+	int64Column("in_packets", func(s *HostFlowStat) int64 { return s.TotalInboundPackets }),
+	int64Column("in_bytes", func(s *HostFlowStat) int64 { return s.TotalInboundBytes }),
+	int64Column("out_packets", func(s *HostFlowStat) int64 { return s.TotalOutboundPackets }),
+	int64Column("out_bytes", func(s *HostFlowStat) int64 { return s.TotalOutboundBytes }),
+	int64Column("conns", func(s *HostFlowStat) int64 { return s.TotalConnections }),
+	{Name: "nat", Value: func(f *HostFlow) string {
+		if f.NAT == nil {
+			return NATNone.String()
+		}
+		return f.NAT.Type.String()
+	}},
+	{Name: "nat_detail", Value: func(f *HostFlow) string {
+		if f.NAT == nil {
+			return ""
+		}
+		return f.NAT.String()
+	}},
+	seenColumn("first_seen", func(s *Seen) string { return s.FirstSeen.Format(time.RFC3339) }),
+	seenColumn("last_seen", func(s *Seen) string { return s.LastSeen.Format(time.RFC3339) }),
+	seenColumn("total_in_packets", func(s *Seen) string { return strconv.FormatInt(s.Totals.TotalInboundPackets, 10) }),
+	seenColumn("total_in_bytes", func(s *Seen) string { return strconv.FormatInt(s.Totals.TotalInboundBytes, 10) }),
+	seenColumn("total_out_packets", func(s *Seen) string { return strconv.FormatInt(s.Totals.TotalOutboundPackets, 10) }),
+	seenColumn("total_out_bytes", func(s *Seen) string { return strconv.FormatInt(s.Totals.TotalOutboundBytes, 10) }),
+	seenColumn("peak_conns", func(s *Seen) string { return strconv.FormatInt(s.Totals.TotalConnections, 10) }),
+}
+
+// DefaultColumns are the column names printed by default.
+var DefaultColumns = []string{
+	"direction", "local_addr", "local_port", "peer_addr", "peer_port",
+	"in_packets", "in_bytes", "out_packets", "out_bytes", "conns",
+}
+
+// ParseColumns parses the comma separated column names such as "direction,peer_addr,peer_port".
+func ParseColumns(s string) ([]*Column, error) {
+	names := DefaultColumns
+	if s != "" {
+		names = strings.Split(s, ",")
+	}
+	columns := make([]*Column, 0, len(names))
+	for _, name := range names {
+		column := lookupColumn(strings.TrimSpace(name))
+		if column == nil {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func lookupColumn(name string) *Column {
+	for _, column := range Columns {
+		if column.Name == name {
+			return column
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package conntrack
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseColumns(t *testing.T) {
+	flow := &HostFlow{
+		Host:      "web01",
+		Direction: FlowActive,
+		Reason:    ReasonEphemeral,
+		Local:     &AddrPort{Addr: "localhost", Port: "many"},
+		Peer:      &AddrPort{Addr: "10.96.0.10", Port: "80"},
+		Stat:      &HostFlowStat{TotalInboundBytes: 1024, TotalConnections: 3},
+		Seen: &Seen{
+			FirstSeen: time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC),
+			LastSeen:  time.Date(2018, 1, 2, 4, 4, 5, 0, time.UTC),
+			Totals:    &HostFlowStat{TotalInboundPackets: 10, TotalInboundBytes: 4096, TotalOutboundPackets: 8, TotalOutboundBytes: 512, TotalConnections: 5},
+		},
+		NAT: &NAT{Type: NATDestination, DNAT: &Translation{
+			Pre:  &AddrPort{Addr: "10.96.0.10", Port: "80"},
+			Post: &AddrPort{Addr: "10.244.1.5", Port: "8080"},
+		}},
+	}
+	tests := []struct {
+		desc     string
+		columns  string
+		expected string
+	}{
+		{
+			desc:     "default",
+			columns:  "",
+			expected: "active,localhost,many,10.96.0.10,80,0,1024,0,0,3",
+		},
+		{
+			desc:     "selected",
+			columns:  "host, direction_reason,nat,nat_detail",
+			expected: "web01,ephemeral,dnat,dnat 10.96.0.10:80->10.244.1.5:8080",
+		},
+		{
+			desc:     "seen",
+			columns:  "first_seen,last_seen,total_in_packets,total_in_bytes,total_out_packets,total_out_bytes,peak_conns",
+			expected: "2018-01-02T03:04:05Z,2018-01-02T04:04:05Z,10,4096,8,512,5",
+		},
+	}
+	for _, tc := range tests {
+		columns, err := ParseColumns(tc.columns)
+		if err != nil {
+			t.Fatalf("desc: %q, ParseColumns should not return error: %v", tc.desc, err)
+		}
+		var values []string
+		for _, column := range columns {
+			values = append(values, column.Value(flow))
+		}
+		if got := strings.Join(values, ","); got != tc.expected {
+			t.Errorf("desc: %q, values should be %q, not %q", tc.desc, tc.expected, got)
+		}
+	}
+
+	if _, err := ParseColumns("direction,foo"); err == nil {
+		t.Error("ParseColumns should return error for the unknown column")
+	}
+}
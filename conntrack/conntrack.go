@@ -6,8 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -24,25 +24,137 @@ const (
 	FlowActive
 	// FlowPassive are 'passive open'
 	FlowPassive
+	// FlowForwarded are forwarded by localhost between other hosts.
+	FlowForwarded
 )
 
-// MarshalJSON returns human readable `mode` format.
-func (c FlowDirection) MarshalJSON() ([]byte, error) {
+// String returns the string representation of the FlowDirection.
+func (c FlowDirection) String() string {
 	switch c {
 	case FlowActive:
-		return json.Marshal("active")
+		return "active"
 	case FlowPassive:
-		return json.Marshal("passive")
+		return "passive"
+	case FlowForwarded:
+		return "forwarded"
 	case FlowUnknown:
-		return json.Marshal("unknown")
+		return "unknown"
+	}
+	return ""
+}
+
+// MarshalJSON returns human readable `mode` format.
+func (c FlowDirection) MarshalJSON() ([]byte, error) {
+	switch c {
+	case FlowActive, FlowPassive, FlowForwarded, FlowUnknown:
+		return json.Marshal(c.String())
 	}
 	return nil, errors.New("unreachable code")
 }
 
+// UnmarshalJSON parses the `mode` format returned by MarshalJSON.
+func (c *FlowDirection) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	for _, dire := range []FlowDirection{FlowActive, FlowPassive, FlowForwarded, FlowUnknown} {
+		if s == dire.String() {
+			*c = dire
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown direction %q", s)
+}
+
 // FilterPorts are ports to filter output.
 type FilterPorts struct {
 	Active  []string
 	Passive []string
+	// Ephemeral are the local ephemeral port range to guess the direction
+	// of the connections whose local port is not in Passive. It can be nil.
+	Ephemeral *netutil.PortRange
+}
+
+// LocalAddrs are the addresses and networks regarded as local.
+type LocalAddrs []*net.IPNet
+
+// NewLocalAddrs returns the LocalAddrs of the IP addresses or CIDRs.
+func NewLocalAddrs(addrs []string) (LocalAddrs, error) {
+	local := make(LocalAddrs, 0, len(addrs))
+	for _, addr := range addrs {
+		if strings.Contains(addr, "/") {
+			_, ipnet, err := net.ParseCIDR(addr)
+			if err != nil {
+				return nil, err
+			}
+			local = append(local, ipnet)
+			continue
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("%s is not IP address", addr)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		local = append(local, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return local, nil
+}
+
+// Contains returns whether addr is local.
+func (l LocalAddrs) Contains(addr string) bool {
+	for _, localNet := range l {
+		if containsAddr(localNet, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultLocalAddrs returns local or the addresses of the host interfaces if local is nil.
+func defaultLocalAddrs(local LocalAddrs) (LocalAddrs, error) {
+	if local != nil {
+		return local, nil
+	}
+	addrs, err := netutil.LocalIPAddrs()
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalAddrs(addrs)
+}
+
+// Owners labels the local endpoints with the name of their owner,
+// such as a container, a systemd unit or a cgroup.
+type Owners struct {
+	// Addrs maps the addresses that are not assigned to the host interfaces,
+	// such as container IPs behind a bridge, to their owner.
+	Addrs map[string]string
+	// Sockets maps the local socket endpoints "<addr>:<port>" to their owner.
+	// The listening sockets are bound to the wildcard address such as "0.0.0.0:80" or "[::]:80".
+	Sockets map[string]string
+}
+
+// lookup returns the owner of the local endpoint or "localhost" if unknown.
+func (o *Owners) lookup(addr, port string) string {
+	if o == nil {
+		return "localhost"
+	}
+	if owner, ok := o.Sockets[net.JoinHostPort(addr, port)]; ok {
+		return owner
+	}
+	// the services listening on all addresses, where IPv6 sockets accept IPv4 too.
+	for _, wildcard := range []string{"0.0.0.0", "::"} {
+		if owner, ok := o.Sockets[net.JoinHostPort(wildcard, port)]; ok {
+			return owner
+		}
+	}
+	if owner, ok := o.Addrs[addr]; ok {
+		return owner
+	}
+	return "localhost"
 }
 
 // flow represents statistics of a connection to other host and port.
@@ -67,6 +179,15 @@ type HostFlowStat struct {
 	TotalInboundBytes    int64 `json:"total_inbound_bytes"`
 	TotalOutboundPackets int64 `json:"total_outbound_packets"`
 	TotalOutboundBytes   int64 `json:"total_outbound_bytes"`
+	TotalConnections     int64 `json:"total_connections"`
+	// entries are the counters of the conntrack entries aggregated into the stat,
+	// which are nil for the stats read from JSON or aggregated with them.
+	entries *entryCounters
+}
+
+// entryCounters are the counters of the conntrack entries by the original tuple.
+type entryCounters struct {
+	byTuple map[string]*HostFlowStat
 }
 
 // String returns the string representation of the HostFlowStat.
@@ -74,23 +195,146 @@ func (s *HostFlowStat) String() string {
 	return fmt.Sprintf("%d \t%d \t%d \t%d", s.TotalInboundPackets, s.TotalInboundBytes, s.TotalOutboundPackets, s.TotalOutboundBytes)
 }
 
+// add adds the packets and bytes of o.
+func (s *HostFlowStat) add(o *HostFlowStat) {
+	s.TotalInboundPackets += o.TotalInboundPackets
+	s.TotalInboundBytes += o.TotalInboundBytes
+	s.TotalOutboundPackets += o.TotalOutboundPackets
+	s.TotalOutboundBytes += o.TotalOutboundBytes
+}
+
+// merge aggregates the stat of the other conntrack entries into s.
+func (s *HostFlowStat) merge(o *HostFlowStat) {
+	s.add(o)
+	s.TotalConnections += o.TotalConnections
+	if s.entries == nil || o.entries == nil {
+		s.entries = nil
+		return
+	}
+	for tuple, e := range o.entries.byTuple {
+		s.entries.byTuple[tuple] = e
+	}
+}
+
+// Sub returns the stat since prev, such as the previous round of the same flow.
+// The deltas are counted per conntrack entry if both have been parsed from conntrack:
+// the entries appearing since prev, or reusing the tuple, are counted from 0, and those
+// closed since prev are not counted, that is, the traffic between prev and their close is missed.
+// Otherwise the aggregated counters are subtracted, where the connections closed since prev
+// leave the negative deltas, which are regarded as 0.
+// The connections are not subtracted since they are the current number.
+func (s *HostFlowStat) Sub(prev *HostFlowStat) *HostFlowStat {
+	if prev == nil {
+		prev = &HostFlowStat{}
+	}
+	if s.entries != nil && prev.entries != nil {
+		d := &HostFlowStat{TotalConnections: s.TotalConnections}
+		for tuple, e := range s.entries.byTuple {
+			d.add(e.subEntry(prev.entries.byTuple[tuple]))
+		}
+		return d
+	}
+	nonNegative := func(v int64) int64 {
+		if v < 0 {
+			return 0
+		}
+		return v
+	}
+	return &HostFlowStat{
+		TotalInboundPackets:  nonNegative(s.TotalInboundPackets - prev.TotalInboundPackets),
+		TotalInboundBytes:    nonNegative(s.TotalInboundBytes - prev.TotalInboundBytes),
+		TotalOutboundPackets: nonNegative(s.TotalOutboundPackets - prev.TotalOutboundPackets),
+		TotalOutboundBytes:   nonNegative(s.TotalOutboundBytes - prev.TotalOutboundBytes),
+		TotalConnections:     s.TotalConnections,
+	}
+}
+
+// subEntry returns the counters of a conntrack entry since prev of the same tuple.
+// The counters decreased mean the tuple reused by a new entry.
+func (s *HostFlowStat) subEntry(prev *HostFlowStat) *HostFlowStat {
+	if prev == nil ||
+		s.TotalInboundPackets < prev.TotalInboundPackets || s.TotalInboundBytes < prev.TotalInboundBytes ||
+		s.TotalOutboundPackets < prev.TotalOutboundPackets || s.TotalOutboundBytes < prev.TotalOutboundBytes {
+		return s
+	}
+	return &HostFlowStat{
+		TotalInboundPackets:  s.TotalInboundPackets - prev.TotalInboundPackets,
+		TotalInboundBytes:    s.TotalInboundBytes - prev.TotalInboundBytes,
+		TotalOutboundPackets: s.TotalOutboundPackets - prev.TotalOutboundPackets,
+		TotalOutboundBytes:   s.TotalOutboundBytes - prev.TotalOutboundBytes,
+	}
+}
+
+// newEntryStat returns the stat of a conntrack entry of the tuple, which can be subtracted per entry.
+func newEntryStat(tuple string, inPackets, inBytes, outPackets, outBytes int64) *HostFlowStat {
+	e := &HostFlowStat{
+		TotalInboundPackets:  inPackets,
+		TotalInboundBytes:    inBytes,
+		TotalOutboundPackets: outPackets,
+		TotalOutboundBytes:   outBytes,
+	}
+	stat := *e
+	stat.TotalConnections = 1
+	stat.entries = &entryCounters{byTuple: map[string]*HostFlowStat{tuple: e}}
+	return &stat
+}
+
 // AddrPort are <addr>:<port>
 type AddrPort struct {
 	Addr string `json:"addr"`
 	Port string `json:"port"`
+	// IP are the numerical address of Addr replaced into the name by ReplaceName,
+	// by which the flow is told apart as well as before resolved. It is empty if Addr are not replaced.
+	IP string `json:"ip,omitempty"`
+}
+
+// resolve replaces Addr into the name by resolve, remembering the numerical address in IP if replaced.
+func (a *AddrPort) resolve(resolve func(addr string) string) {
+	if name := resolve(a.Addr); name != a.Addr {
+		if a.IP == "" {
+			a.IP = a.Addr
+		}
+		a.Addr = name
+	}
+}
+
+// numerical returns a itself, or the copy of a whose Addr are turned back into IP if replaced into the name.
+func (a *AddrPort) numerical() *AddrPort {
+	if a.IP == "" {
+		return a
+	}
+	return &AddrPort{Addr: a.IP, Port: a.Port}
 }
 
 // String returns the string representation of the AddrPort.
 func (a *AddrPort) String() string {
+	if net.ParseIP(a.Addr) == nil {
+		// names such as "container:3f4e8a9c2b1d" are not enclosed in brackets.
+		return a.Addr + ":" + a.Port
+	}
 	return net.JoinHostPort(a.Addr, a.Port)
 }
 
 // HostFlow represents a `host flow`.
+// Local are the client and Peer are the server on FlowForwarded.
 type HostFlow struct {
+	// Host are the hostname where the flow is observed. It is empty if unknown.
+	Host string `json:"host,omitempty"`
+	// HostAddrs are the addresses of the host where the flow is observed, which --json prints
+	// so that the flows of the hosts are paired by the numerical peers. They are empty if unknown.
+	HostAddrs []string      `json:"host_addrs,omitempty"`
 	Direction FlowDirection `json:"direction"`
-	Local     *AddrPort     `json:"local"`
-	Peer      *AddrPort     `json:"peer"`
-	Stat      *HostFlowStat `json:"stat"`
+	// Reason are how the direction is determined.
+	Reason DirectionReason `json:"direction_reason"`
+	Local  *AddrPort       `json:"local"`
+	Peer   *AddrPort       `json:"peer"`
+	Stat   *HostFlowStat   `json:"stat"`
+	// Netns are the label of the network namespace where the flow is tracked.
+	Netns string `json:"netns,omitempty"`
+	// NAT are the address translations of the flow. It is nil if not translated.
+	NAT *NAT `json:"nat,omitempty"`
+	// Seen are when the flow is seen across the rounds by Tracker. It is nil if not tracked.
+	Seen *Seen `json:"seen,omitempty"`
 }
 
 // HasDirection returns whether .
@@ -100,23 +344,71 @@ func (f *HostFlow) HasDirection(dire FlowDirection) bool {
 
 // String returns the string representation of HostFlow.
 func (f *HostFlow) String() string {
-	switch f.Direction {
-	case FlowActive:
-		return fmt.Sprintf("%s\t --> \t%s \t%s", f.Local, f.Peer, f.Stat)
-	case FlowPassive:
-		return fmt.Sprintf("%s\t <-- \t%s \t%s", f.Local, f.Peer, f.Stat)
+	return fmt.Sprintf("%s \t%s", f.Endpoints(), f.Stat)
+}
+
+// Endpoints returns the string representation of the local and peer endpoints.
+func (f *HostFlow) Endpoints() string {
+	// the guessed directions are marked with '?'.
+	switch {
+	case f.Direction == FlowActive && f.Reason.Guessed():
+		return fmt.Sprintf("%s\t -->? \t%s", f.Local, f.Peer)
+	case f.Direction == FlowPassive && f.Reason.Guessed():
+		return fmt.Sprintf("%s\t <--? \t%s", f.Local, f.Peer)
+	case f.Direction == FlowActive || f.Direction == FlowForwarded:
+		return fmt.Sprintf("%s\t --> \t%s", f.Local, f.Peer)
+	case f.Direction == FlowPassive:
+		return fmt.Sprintf("%s\t <-- \t%s", f.Local, f.Peer)
 	}
 	return ""
 }
 
 // ReplaceLookupedName replaces f.Addr into lookuped name.
 func (f *HostFlow) ReplaceLookupedName() {
-	f.Peer.Addr = netutil.ResolveAddr(f.Peer.Addr)
+	f.ReplaceName(netutil.ResolveAddr)
+}
+
+// ReplaceName replaces the peer address, the client address on FlowForwarded
+// and the DNAT backend address into the names by resolve.
+// The numerical addresses are kept in IP of the endpoints, so that the unique key does not change.
+func (f *HostFlow) ReplaceName(resolve func(addr string) string) {
+	f.Peer.resolve(resolve)
+	if f.Direction == FlowForwarded && net.ParseIP(f.Local.Addr) != nil {
+		f.Local.resolve(resolve)
+	}
+	if f.NAT != nil && f.NAT.DNAT != nil {
+		f.NAT.DNAT.Post.resolve(resolve)
+	}
 }
 
-// UniqKey returns the unique key for connections aggregation
+// Resolved returns the copy of f whose addresses are replaced into the names by resolve
+// as ReplaceName, leaving f numerical for the other outputs.
+func (f *HostFlow) Resolved(resolve func(addr string) string) *HostFlow {
+	c := *f
+	local, peer := *f.Local, *f.Peer
+	c.Local, c.Peer = &local, &peer
+	if f.NAT != nil && f.NAT.DNAT != nil {
+		nat, dnat, post := *f.NAT, *f.NAT.DNAT, *f.NAT.DNAT.Post
+		dnat.Post = &post
+		nat.DNAT = &dnat
+		c.NAT = &nat
+	}
+	c.ReplaceName(resolve)
+	return &c
+}
+
+// UniqKey returns the unique key for connections aggregation.
+// The key are of the numerical addresses even if they are replaced into the names.
 func (f *HostFlow) UniqKey() string {
-	return fmt.Sprintf("%d-%s-%s", f.Direction, f.Local, f.Peer)
+	key := fmt.Sprintf("%d-%s-%s", f.Direction, f.Local.numerical(), f.Peer.numerical())
+	if f.Netns != "" {
+		key = f.Netns + "-" + key
+	}
+	if f.NAT != nil {
+		// flows to a virtual IP are aggregated by the translated backend.
+		key = key + "-" + f.NAT.numerical().String()
+	}
+	return key
 }
 
 // HostFlows represents a group of host flow by unique key.
@@ -128,21 +420,64 @@ func (hf HostFlows) insert(flow *HostFlow) {
 		hf[key] = flow
 		return
 	}
-	switch flow.Direction {
-	case FlowActive:
-		hf[key].Stat.TotalInboundPackets += flow.Stat.TotalInboundPackets
-		hf[key].Stat.TotalInboundBytes += flow.Stat.TotalInboundBytes
-		hf[key].Stat.TotalOutboundPackets += flow.Stat.TotalOutboundPackets
-		hf[key].Stat.TotalOutboundBytes += flow.Stat.TotalOutboundBytes
-	case FlowPassive:
-		hf[key].Stat.TotalInboundPackets += flow.Stat.TotalInboundPackets
-		hf[key].Stat.TotalInboundBytes += flow.Stat.TotalInboundBytes
-		hf[key].Stat.TotalOutboundPackets += flow.Stat.TotalOutboundPackets
-		hf[key].Stat.TotalOutboundBytes += flow.Stat.TotalOutboundBytes
+	if hf[key].Reason.Guessed() && !flow.Reason.Guessed() {
+		hf[key].Reason = flow.Reason
 	}
+	hf[key].Stat.merge(flow.Stat)
 	return
 }
 
+// Resolved returns the copies of the flows resolved by HostFlow.Resolved, or hf itself if resolve is nil.
+func (hf HostFlows) Resolved(resolve func(addr string) string) HostFlows {
+	if resolve == nil {
+		return hf
+	}
+	flows := make(HostFlows, len(hf))
+	for key, flow := range hf {
+		flows[key] = flow.Resolved(resolve)
+	}
+	return flows
+}
+
+// Merge aggregates flows into hf.
+func (hf HostFlows) Merge(flows HostFlows) {
+	for _, flow := range flows {
+		hf.insert(flow)
+	}
+}
+
+// Filter returns the flows that have the direction.
+func (hf HostFlows) Filter(dire FlowDirection) HostFlows {
+	flows := HostFlows{}
+	for key, flow := range hf {
+		if !flow.HasDirection(dire) {
+			flows[key] = flow
+		}
+	}
+	return flows
+}
+
+// List returns the flows sorted by the unique key.
+func (hf HostFlows) List() []*HostFlow {
+	list := make([]*HostFlow, 0, len(hf))
+	for _, flow := range hf {
+		list = append(list, flow)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].UniqKey() < list[j].UniqKey()
+	})
+	return list
+}
+
+// ReadHostFlows reads the host flows printed as json format, either the envelope or the bare list.
+func ReadHostFlows(r io.Reader) (HostFlows, error) {
+	env, err := ReadEnvelope(r)
+	if err != nil {
+		return nil, err
+	}
+	return env.Flows, nil
+}
+
 // MarshalJSON returns list formats not map.
 func (hf HostFlows) MarshalJSON() ([]byte, error) {
 	list := make([]HostFlow, 0, len(hf))
@@ -152,71 +487,86 @@ func (hf HostFlows) MarshalJSON() ([]byte, error) {
 	return json.Marshal(list)
 }
 
-// toHostFlow converts into HostFlow.
-func (f *flow) toHostFlow(localAddrs []string, fports FilterPorts) *HostFlow {
-	var (
-		direction  FlowDirection
-		addr, port string
-	)
-	for _, localAddr := range localAddrs {
+// endpoints are the local and peer endpoints of a connection.
+type endpoints struct {
+	direction    FlowDirection
+	reason       DirectionReason
+	laddr, lport string
+	paddr, pport string
+	// originated are whether the local endpoint is the source of the original tuple.
+	originated bool
+}
+
+// endpointsByPorts determines the endpoints by the local addresses and the filter ports.
+func (f *flow) endpointsByPorts(local LocalAddrs, fports FilterPorts) *endpoints {
+	for _, localNet := range local {
 		// not filter by ports on ActiveOpen connection if ports is empty
-		if f.originalSaddr == localAddr && (len(fports.Active) == 0 || contains(fports.Active, f.originalDport)) {
-			direction, addr, port = FlowActive, f.originalDaddr, f.originalDport
-			break
+		if containsAddr(localNet, f.originalSaddr) && (len(fports.Active) == 0 || contains(fports.Active, f.originalDport)) {
+			return &endpoints{FlowActive, ReasonOriginal, f.originalSaddr, f.originalSport, f.originalDaddr, f.originalDport, true}
 		}
-		if f.replyDaddr == localAddr && (len(fports.Active) == 0 || contains(fports.Active, f.replySport)) {
-			direction, addr, port = FlowActive, f.replySaddr, f.replySport
-			break
+		if containsAddr(localNet, f.replyDaddr) && (len(fports.Active) == 0 || contains(fports.Active, f.replySport)) {
+			return &endpoints{FlowActive, ReasonOriginal, f.replyDaddr, f.replyDport, f.replySaddr, f.replySport, true}
 		}
-		if f.originalDaddr == localAddr && contains(fports.Passive, f.originalDport) {
-			direction, addr, port = FlowPassive, f.originalSaddr, f.originalDport // not OriginalSport
-			break
+		if containsAddr(localNet, f.originalDaddr) && contains(fports.Passive, f.originalDport) {
+			return &endpoints{FlowPassive, ReasonListening, f.originalDaddr, f.originalDport, f.originalSaddr, f.originalSport, false}
 		}
-		if f.replySaddr == localAddr && contains(fports.Passive, f.replySport) {
-			direction, addr, port = FlowPassive, f.replyDaddr, f.replySport // not ReplyDport
-			break
+		if containsAddr(localNet, f.replySaddr) && contains(fports.Passive, f.replySport) {
+			return &endpoints{FlowPassive, ReasonListening, f.replySaddr, f.replySport, f.replyDaddr, f.replyDport, false}
 		}
 	}
-	switch direction {
-	case FlowUnknown:
+	return nil
+}
+
+// tuple returns the original tuple, which identifies the conntrack entry.
+func (f *flow) tuple() string {
+	return net.JoinHostPort(f.originalSaddr, f.originalSport) + "->" + net.JoinHostPort(f.originalDaddr, f.originalDport)
+}
+
+// toHostFlow converts into HostFlow.
+func (f *flow) toHostFlow(local LocalAddrs, fports FilterPorts, owners *Owners) *HostFlow {
+	e := f.endpointsByPorts(local, fports)
+	if e == nil && fports.Ephemeral != nil {
+		e = f.endpointsByEphemeral(local, fports)
+	}
+	if e == nil {
 		return nil
+	}
+	stat := newEntryStat(f.tuple(), f.originalPackets, f.originalBytes, f.replyPackets, f.replyBytes)
+	if e.originated {
+		stat = newEntryStat(f.tuple(), f.replyPackets, f.replyBytes, f.originalPackets, f.originalBytes)
+	}
+	switch e.direction {
 	case FlowActive:
 		return &HostFlow{
 			Direction: FlowActive,
-			Local:     &AddrPort{Addr: "localhost", Port: "many"},
-			Peer:      &AddrPort{Addr: addr, Port: port},
-			Stat: &HostFlowStat{
-				TotalInboundPackets:  f.replyPackets,
-				TotalInboundBytes:    f.replyBytes,
-				TotalOutboundPackets: f.originalPackets,
-				TotalOutboundBytes:   f.originalBytes,
-			},
+			Reason:    e.reason,
+			Local:     &AddrPort{Addr: owners.lookup(e.laddr, e.lport), Port: "many"},
+			Peer:      &AddrPort{Addr: e.paddr, Port: e.pport},
+			NAT:       f.nat(),
+			Stat:      stat,
 		}
 	case FlowPassive:
 		return &HostFlow{
 			Direction: FlowPassive,
-			Local:     &AddrPort{Addr: "localhost", Port: port},
-			Peer:      &AddrPort{Addr: addr, Port: "many"},
-			Stat: &HostFlowStat{
-				TotalInboundPackets:  f.originalPackets,
-				TotalInboundBytes:    f.originalBytes,
-				TotalOutboundPackets: f.replyPackets,
-				TotalOutboundBytes:   f.replyBytes,
-			},
+			Reason:    e.reason,
+			Local:     &AddrPort{Addr: owners.lookup(e.laddr, e.lport), Port: e.lport},
+			Peer:      &AddrPort{Addr: e.paddr, Port: "many"},
+			NAT:       f.nat(),
+			Stat:      stat,
 		}
 	}
 	return nil
 }
 
-func parseLine(line string) *flow {
+// parseLine parses a conntrack entry. It returns nil without error for
+// the empty line and the entries other than tcp, and returns error on the malformed line.
+func parseLine(line string) (*flow, error) {
 	flow := &flow{}
 	fields := strings.Fields(line)
-	if len(fields) == 0 {
-		log.Fatalf("unexpected line: %s\n", line)
-	}
-	if fields[0] != "tcp" {
-		return nil
+	if len(fields) == 0 || fields[0] != "tcp" {
+		return nil, nil
 	}
+	e := &entryFields{line: line, fields: fields}
 	var packets, bytes bool
 	if strings.Contains(line, "packets=") {
 		packets = true
@@ -227,90 +577,146 @@ func parseLine(line string) *flow {
 	if strings.Contains(line, "[UNREPLIED]") {
 		// tcp      6 367755 ESTABLISHED src=10.0.0.1 dst=10.0.0.2 sport=3306 dport=38205 packets=1 bytes=52 [UNREPLIED] src=10.0.0.2 dst=10.0.0.1 sport=38205 dport=3306 packets=0 bytes=0 mark=0 secmark=0 use=1
 		i := 4
-		flow.originalSaddr = strings.Split(fields[i], "=")[1]
-		flow.originalDaddr = strings.Split(fields[i+1], "=")[1]
-		flow.originalSport = strings.Split(fields[i+2], "=")[1]
-		flow.originalDport = strings.Split(fields[i+3], "=")[1]
+		flow.originalSaddr = e.value(i)
+		flow.originalDaddr = e.value(i + 1)
+		flow.originalSport = e.value(i + 2)
+		flow.originalDport = e.value(i + 3)
 		i = i + 4
 		if bytes {
-			flow.originalPackets, _ = strconv.ParseInt(strings.Split(fields[i], "=")[1], 10, 64)
+			flow.originalPackets = e.int64(i)
 			i++
 		}
 		if packets {
-			flow.originalBytes, _ = strconv.ParseInt(strings.Split(fields[i], "=")[1], 10, 64)
+			flow.originalBytes = e.int64(i)
 			i++
 		}
 		i = i + 1
-		flow.replySaddr = strings.Split(fields[i], "=")[1]
-		flow.replyDaddr = strings.Split(fields[i+1], "=")[1]
-		flow.replySport = strings.Split(fields[i+2], "=")[1]
-		flow.replyDport = strings.Split(fields[i+3], "=")[1]
+		flow.replySaddr = e.value(i)
+		flow.replyDaddr = e.value(i + 1)
+		flow.replySport = e.value(i + 2)
+		flow.replyDport = e.value(i + 3)
 		i = i + 4
 		if packets {
-			flow.replyPackets, _ = strconv.ParseInt(strings.Split(fields[i], "=")[1], 10, 64)
+			flow.replyPackets = e.int64(i)
 			i++
 		}
 		if bytes {
-			flow.replyBytes, _ = strconv.ParseInt(strings.Split(fields[i], "=")[1], 10, 64)
+			flow.replyBytes = e.int64(i)
 			i++
 		}
-		return flow
+		if e.err != nil {
+			return nil, e.err
+		}
+		return flow, nil
 	} else if strings.Contains(line, "[ASSURED]") {
 		// tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.0.11 sport=41143 dport=443 packets=3 bytes=164 src=10.0.0.11 dst=10.0.0.10 sport=443 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
 		i := 4
-		flow.originalSaddr = strings.Split(fields[i], "=")[1]
-		flow.originalDaddr = strings.Split(fields[i+1], "=")[1]
-		flow.originalSport = strings.Split(fields[i+2], "=")[1]
-		flow.originalDport = strings.Split(fields[i+3], "=")[1]
+		flow.originalSaddr = e.value(i)
+		flow.originalDaddr = e.value(i + 1)
+		flow.originalSport = e.value(i + 2)
+		flow.originalDport = e.value(i + 3)
 		i = i + 4
 		if packets {
-			flow.originalPackets, _ = strconv.ParseInt(strings.Split(fields[i], "=")[1], 10, 64)
+			flow.originalPackets = e.int64(i)
 			i++
 		}
 		if bytes {
-			flow.originalBytes, _ = strconv.ParseInt(strings.Split(fields[i], "=")[1], 10, 64)
+			flow.originalBytes = e.int64(i)
 			i++
 		}
-		flow.replySaddr = strings.Split(fields[i], "=")[1]
-		flow.replyDaddr = strings.Split(fields[i+1], "=")[1]
-		flow.replySport = strings.Split(fields[i+2], "=")[1]
-		flow.replyDport = strings.Split(fields[i+3], "=")[1]
+		flow.replySaddr = e.value(i)
+		flow.replyDaddr = e.value(i + 1)
+		flow.replySport = e.value(i + 2)
+		flow.replyDport = e.value(i + 3)
 		i = i + 4
 		if packets {
-			flow.replyPackets, _ = strconv.ParseInt(strings.Split(fields[i], "=")[1], 10, 64)
+			flow.replyPackets = e.int64(i)
 			i++
 		}
 		if bytes {
-			flow.replyBytes, _ = strconv.ParseInt(strings.Split(fields[i], "=")[1], 10, 64)
+			flow.replyBytes = e.int64(i)
 			i++
 		}
-		return flow
+		if e.err != nil {
+			return nil, e.err
+		}
+		return flow, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// entryFields are the fields of a conntrack entry to read the `key=value` fields.
+type entryFields struct {
+	line   string
+	fields []string
+	// err are the first error on reading the fields.
+	err error
+}
+
+// value returns the value of the i-th field, or sets err if the field is not `key=value`.
+func (e *entryFields) value(i int) string {
+	if e.err != nil {
+		return ""
+	}
+	if i >= len(e.fields) {
+		e.err = fmt.Errorf("malformed conntrack entry: %s", e.line)
+		return ""
+	}
+	kv := strings.SplitN(e.fields[i], "=", 2)
+	if len(kv) != 2 {
+		e.err = fmt.Errorf("malformed conntrack entry: %s", e.line)
+		return ""
+	}
+	return kv[1]
+}
+
+// int64 returns the value of the i-th field as a counter, which is 0 if it is not a number.
+func (e *entryFields) int64(i int) int64 {
+	v, _ := strconv.ParseInt(e.value(i), 10, 64)
+	return v
 }
 
 // ParseEntries parses '/proc/net/nf_conntrack or /proc/net/ip_conntrack'.
-func ParseEntries(r io.Reader, fports FilterPorts) (HostFlows, error) {
-	localAddrs, err := netutil.LocalIPAddrs()
+// The addresses of the host interfaces are regarded as local if local is nil,
+// and the addresses of owners are regarded as local in addition. owners can be nil.
+// It skips the malformed entries and returns the number of them.
+func ParseEntries(r io.Reader, local LocalAddrs, fports FilterPorts, owners *Owners) (HostFlows, int, error) {
+	local, err := defaultLocalAddrs(local)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	if owners != nil {
+		addrs := make([]string, 0, len(owners.Addrs))
+		for addr := range owners.Addrs {
+			addrs = append(addrs, addr)
+		}
+		ownerAddrs, err := NewLocalAddrs(addrs)
+		if err != nil {
+			return nil, 0, err
+		}
+		local = append(append(LocalAddrs{}, local...), ownerAddrs...)
 	}
 	hostFlows := HostFlows{}
+	var malformed int
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := scanner.Text()
-		flow := parseLine(line)
+		flow, err := parseLine(line)
+		if err != nil {
+			malformed++
+			continue
+		}
 		if flow == nil {
 			continue
 		}
-		hostFlow := flow.toHostFlow(localAddrs, fports)
+		hostFlow := flow.toHostFlow(local, fports, owners)
 		if hostFlow == nil {
 			continue
 		}
 		hostFlows.insert(hostFlow)
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return nil, malformed, err
 	}
-	return hostFlows, nil
+	return hostFlows, malformed, nil
 }
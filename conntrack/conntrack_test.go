@@ -1,11 +1,24 @@
 package conntrack
 
-import "testing"
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func mustParseLine(t *testing.T, line string) *flow {
+	t.Helper()
+	f, err := parseLine(line)
+	if err != nil || f == nil {
+		t.Fatalf("parseLine(%q) should return the flow, not %v, %v", line, f, err)
+	}
+	return f
+}
 
 func TestParseLine(t *testing.T) {
 	t.Run("[UNREPLIRED]", func(t *testing.T) {
 		line := "tcp      6 367755 ESTABLISHED src=10.0.0.1 dst=10.0.0.2 sport=3306 dport=38205 packets=1 bytes=52 [UNREPLIED] src=10.0.0.2 dst=10.0.0.1 sport=38205 dport=3306 packets=0 bytes=0 mark=0 secmark=0 use=1"
-		rstat := parseLine(line)
+		rstat := mustParseLine(t, line)
 		if rstat.originalSaddr != "10.0.0.1" {
 			t.Errorf("OriginalSaddr should be 10.0.0.1, not %v", rstat.originalSaddr)
 		}
@@ -46,7 +59,7 @@ func TestParseLine(t *testing.T) {
 
 	t.Run("[ASSURED]", func(t *testing.T) {
 		line := "tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.0.11 sport=41143 dport=443 packets=3 bytes=164 src=10.0.0.11 dst=10.0.0.10 sport=443 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1"
-		rstat := parseLine(line)
+		rstat := mustParseLine(t, line)
 		if rstat.originalSaddr != "10.0.0.10" {
 			t.Errorf("OriginalSaddr should be 10.0.0.10, not %v", rstat.originalSaddr)
 		}
@@ -84,4 +97,165 @@ func TestParseLine(t *testing.T) {
 			t.Errorf("ReplyBytes should be 60, not %v", rstat.replyBytes)
 		}
 	})
+
+	t.Run("ignored", func(t *testing.T) {
+		for _, line := range []string{
+			"",
+			"udp      17 29 src=10.0.0.10 dst=10.0.0.2 sport=41143 dport=53 packets=1 bytes=60 src=10.0.0.2 dst=10.0.0.10 sport=53 dport=41143 packets=1 bytes=120 mark=0 use=1",
+		} {
+			if f, err := parseLine(line); f != nil || err != nil {
+				t.Errorf("parseLine(%q) should return nil without error, not %v, %v", line, f, err)
+			}
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, line := range []string{
+			"tcp      6 5 CLOSE src=10.0.0.10 [ASSURED]",
+			"tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.0.11 sport dport=443 packets=3 bytes=164 src=10.0.0.11 dst=10.0.0.10 sport=443 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+		} {
+			if f, err := parseLine(line); err == nil {
+				t.Errorf("parseLine(%q) should return error, not %v", line, f)
+			}
+		}
+	})
+}
+
+func TestToHostFlow_owners(t *testing.T) {
+	owners := &Owners{
+		Addrs: map[string]string{"172.17.0.2": "container:3f4e8a9c2b1d"},
+		Sockets: map[string]string{
+			"10.0.0.10:41143": "systemd:app.service",
+			"0.0.0.0:3306":    "systemd:mysqld.service",
+			"[::]:443":        "container:9a8b7c6d5e4f",
+		},
+	}
+	tests := []struct {
+		desc  string
+		line  string
+		local AddrPort
+	}{
+		{
+			desc:  "container address",
+			line:  "tcp      6 5 CLOSE src=172.17.0.2 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=172.17.0.2 sport=3306 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			local: AddrPort{Addr: "container:3f4e8a9c2b1d", Port: "many"},
+		},
+		{
+			desc:  "socket",
+			line:  "tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			local: AddrPort{Addr: "systemd:app.service", Port: "many"},
+		},
+		{
+			desc:  "unknown",
+			line:  "tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.1.10 sport=41144 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41144 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			local: AddrPort{Addr: "localhost", Port: "many"},
+		},
+		{
+			desc:  "listening on 0.0.0.0",
+			line:  "tcp      6 5 CLOSE src=10.0.1.10 dst=10.0.0.10 sport=52110 dport=3306 packets=3 bytes=164 src=10.0.0.10 dst=10.0.1.10 sport=3306 dport=52110 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			local: AddrPort{Addr: "systemd:mysqld.service", Port: "3306"},
+		},
+		{
+			desc:  "listening on ::",
+			line:  "tcp      6 5 CLOSE src=10.0.1.10 dst=10.0.0.10 sport=52111 dport=443 packets=3 bytes=164 src=10.0.0.10 dst=10.0.1.10 sport=443 dport=52111 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			local: AddrPort{Addr: "container:9a8b7c6d5e4f", Port: "443"},
+		},
+	}
+	local, _ := NewLocalAddrs([]string{"10.0.0.10", "172.17.0.2"})
+	fports := FilterPorts{Active: []string{"3306"}, Passive: []string{"3306", "443"}}
+	for _, tc := range tests {
+		hf := mustParseLine(t, tc.line).toHostFlow(local, fports, owners)
+		if hf == nil {
+			t.Fatalf("desc: %q, toHostFlow should not be nil", tc.desc)
+		}
+		if *hf.Local != tc.local {
+			t.Errorf("desc: %q, local should be %v, not %v", tc.desc, tc.local, *hf.Local)
+		}
+	}
+}
+
+func TestHostFlowStat_Sub(t *testing.T) {
+	tests := []struct {
+		desc     string
+		prev     *HostFlowStat
+		expected HostFlowStat
+	}{
+		{
+			desc:     "no previous stat",
+			prev:     nil,
+			expected: HostFlowStat{TotalInboundPackets: 10, TotalInboundBytes: 1000, TotalOutboundPackets: 5, TotalOutboundBytes: 500, TotalConnections: 2},
+		},
+		{
+			desc:     "increased",
+			prev:     &HostFlowStat{TotalInboundPackets: 4, TotalInboundBytes: 400, TotalOutboundPackets: 5, TotalOutboundBytes: 100, TotalConnections: 3},
+			expected: HostFlowStat{TotalInboundPackets: 6, TotalInboundBytes: 600, TotalOutboundBytes: 400, TotalConnections: 2},
+		},
+		{
+			desc:     "connections closed",
+			prev:     &HostFlowStat{TotalInboundPackets: 20, TotalInboundBytes: 2000, TotalOutboundPackets: 5, TotalOutboundBytes: 500, TotalConnections: 4},
+			expected: HostFlowStat{TotalConnections: 2},
+		},
+	}
+	cur := &HostFlowStat{TotalInboundPackets: 10, TotalInboundBytes: 1000, TotalOutboundPackets: 5, TotalOutboundBytes: 500, TotalConnections: 2}
+	for _, tc := range tests {
+		if got := cur.Sub(tc.prev); *got != tc.expected {
+			t.Errorf("desc: %q, Sub should be %v, not %v", tc.desc, tc.expected, *got)
+		}
+	}
+}
+
+func TestHostFlowStat_Sub_entries(t *testing.T) {
+	// the entries to 10.0.1.10:3306 from the source port with the inbound bytes.
+	entries := func(bytes map[string]int64) string {
+		var lines []string
+		for sport, b := range bytes {
+			lines = append(lines, fmt.Sprintf("tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=%s dport=3306 packets=1 bytes=60 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=%s packets=1 bytes=%d [ASSURED] mark=0 secmark=0 use=1", sport, sport, b))
+		}
+		return strings.Join(lines, "\n")
+	}
+	tests := []struct {
+		desc     string
+		prev     map[string]int64
+		cur      map[string]int64
+		expected int64
+	}{
+		{"increased", map[string]int64{"41143": 1000}, map[string]int64{"41143": 1600}, 600},
+		// the bytes of 41144 since the previous round are missed since the entry has gone.
+		{"connection closed", map[string]int64{"41143": 1000, "41144": 5000}, map[string]int64{"41143": 1600}, 600},
+		{"connection opened", map[string]int64{"41143": 1000}, map[string]int64{"41143": 1600, "41144": 300}, 900},
+		{"tuple reused", map[string]int64{"41143": 1000}, map[string]int64{"41143": 200}, 200},
+	}
+	local, _ := NewLocalAddrs([]string{"10.0.0.10"})
+	stat := func(bytes map[string]int64) *HostFlowStat {
+		flows, _, err := ParseEntries(strings.NewReader(entries(bytes)), local, FilterPorts{}, nil)
+		if err != nil || len(flows) != 1 {
+			t.Fatalf("ParseEntries should return a flow, not %v, %v", flows, err)
+		}
+		return flows.List()[0].Stat
+	}
+	for _, tc := range tests {
+		if got := stat(tc.cur).Sub(stat(tc.prev)); got.TotalInboundBytes != tc.expected {
+			t.Errorf("desc: %q, Sub should count %d inbound bytes, not %d", tc.desc, tc.expected, got.TotalInboundBytes)
+		}
+	}
+}
+
+func TestHostFlow_Resolved(t *testing.T) {
+	flow := &HostFlow{
+		Direction: FlowActive,
+		Local:     &AddrPort{Addr: "localhost", Port: "many"},
+		Peer:      &AddrPort{Addr: "10.96.0.10", Port: "80"},
+		Stat:      &HostFlowStat{},
+		NAT: &NAT{Type: NATDestination, DNAT: &Translation{
+			Pre:  &AddrPort{Addr: "10.96.0.10", Port: "80"},
+			Post: &AddrPort{Addr: "10.244.1.5", Port: "8080"},
+		}},
+	}
+	resolved := flow.Resolved(func(addr string) string { return "name-" + addr })
+	if resolved.Peer.Addr != "name-10.96.0.10" || resolved.NAT.DNAT.Post.Addr != "name-10.244.1.5" {
+		t.Errorf("Resolved should replace the addresses, not %v %v", resolved.Peer, resolved.NAT)
+	}
+	if flow.Peer.Addr != "10.96.0.10" || flow.NAT.DNAT.Post.Addr != "10.244.1.5" {
+		t.Errorf("Resolved should not replace the addresses of the original flow, not %v %v", flow.Peer, flow.NAT)
+	}
 }
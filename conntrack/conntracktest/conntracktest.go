@@ -0,0 +1,37 @@
+package conntracktest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+// Host are the local addresses, the listening ports and the owners of the host
+// that the conntrack entries of the tests are collected on.
+type Host struct {
+	Locals  []string
+	Passive []string
+	Owners  *conntrack.Owners
+}
+
+// Web are the host of 10.0.0.10 listening on the port 80, which most of the tests are collected on.
+var Web = Host{Locals: []string{"10.0.0.10"}, Passive: []string{"80"}}
+
+// Parse returns the host flows of the conntrack entries collected on the host.
+// It fails the test if the entries cannot be parsed or any of them are malformed.
+func (h Host) Parse(t testing.TB, entries string) conntrack.HostFlows {
+	t.Helper()
+	local, err := conntrack.NewLocalAddrs(h.Locals)
+	if err != nil {
+		t.Fatalf("the local addresses %v should be valid: %v", h.Locals, err)
+	}
+	flows, malformed, err := conntrack.ParseEntries(strings.NewReader(entries), local, conntrack.FilterPorts{Passive: h.Passive}, h.Owners)
+	if err != nil {
+		t.Fatalf("the entries should be parsed: %v", err)
+	}
+	if malformed > 0 {
+		t.Fatalf("none of the entries should be malformed, but %d are", malformed)
+	}
+	return flows
+}
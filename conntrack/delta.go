@@ -0,0 +1,31 @@
+package conntrack
+
+import "time"
+
+// DeltaTracker counts the deltas of the host flows since the previous round by the unique key,
+// for the sinks of the counters per interval such as StatsD, IPFIX and OTLP.
+// The first round has no previous round since the counters of conntrack have been accumulated
+// from the start of the connections. The flows appearing after the first round are counted from 0.
+// The zero value are ready to track.
+type DeltaTracker struct {
+	prev   map[string]*HostFlowStat
+	prevAt time.Time
+}
+
+// Deltas returns the copies of the flows whose stats are the deltas by HostFlowStat.Sub since the previous round,
+// and when the previous round was, which is zero on the first round. The flows are remembered as the previous round at the time.
+func (d *DeltaTracker) Deltas(flows HostFlows, at time.Time) (HostFlows, time.Time) {
+	deltas := make(HostFlows, len(flows))
+	for key, flow := range flows {
+		c := *flow
+		c.Stat = flow.Stat.Sub(d.prev[key])
+		deltas[key] = &c
+	}
+	since := d.prevAt
+	d.prev = make(map[string]*HostFlowStat, len(flows))
+	for key, flow := range flows {
+		d.prev[key] = flow.Stat
+	}
+	d.prevAt = at
+	return deltas, since
+}
@@ -0,0 +1,61 @@
+package conntrack
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeltaTracker_Deltas(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	flow := func(peer string, bytes, conns int64) *HostFlow {
+		return &HostFlow{
+			Direction: FlowActive,
+			Local:     &AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &AddrPort{Addr: peer, Port: "3306"},
+			Stat:      &HostFlowStat{TotalInboundBytes: bytes, TotalConnections: conns},
+		}
+	}
+	flows := func(fs ...*HostFlow) HostFlows {
+		hf := HostFlows{}
+		for _, f := range fs {
+			hf[f.UniqKey()] = f
+		}
+		return hf
+	}
+	tests := []struct {
+		desc     string
+		flows    HostFlows
+		since    time.Time
+		expected map[string]int64 // the inbound bytes by the peer
+	}{
+		{"first", flows(flow("10.0.1.10", 100, 1)), time.Time{}, map[string]int64{"10.0.1.10": 100}},
+		{"increased", flows(flow("10.0.1.10", 300, 2)), at, map[string]int64{"10.0.1.10": 200}},
+		{"appeared", flows(flow("10.0.1.10", 300, 2), flow("10.0.1.11", 50, 1)), at.Add(time.Minute), map[string]int64{"10.0.1.10": 0, "10.0.1.11": 50}},
+		// 10.0.1.10 gone in the previous round is counted from 0.
+		{"seen again", flows(flow("10.0.1.11", 60, 1)), at.Add(2 * time.Minute), map[string]int64{"10.0.1.11": 10}},
+		{"counted from 0", flows(flow("10.0.1.10", 40, 1)), at.Add(3 * time.Minute), map[string]int64{"10.0.1.10": 40}},
+	}
+	var d DeltaTracker
+	for i, tc := range tests {
+		before := tc.flows.List()[0].Stat.TotalInboundBytes
+		deltas, since := d.Deltas(tc.flows, at.Add(time.Duration(i)*time.Minute))
+		if !since.Equal(tc.since) {
+			t.Errorf("desc: %q, since should be %v, not %v", tc.desc, tc.since, since)
+		}
+		got := map[string]int64{}
+		for _, flow := range deltas {
+			got[flow.Peer.Addr] = flow.Stat.TotalInboundBytes
+		}
+		if len(got) != len(tc.expected) {
+			t.Errorf("desc: %q, deltas should be %v, not %v", tc.desc, tc.expected, got)
+		}
+		for peer, bytes := range tc.expected {
+			if got[peer] != bytes {
+				t.Errorf("desc: %q, deltas should be %v, not %v", tc.desc, tc.expected, got)
+			}
+		}
+		if after := tc.flows.List()[0].Stat.TotalInboundBytes; after != before {
+			t.Errorf("desc: %q, the flows should not be modified, %d, not %d", tc.desc, before, after)
+		}
+	}
+}
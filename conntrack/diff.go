@@ -0,0 +1,94 @@
+package conntrack
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+)
+
+// DiffType represents how a host flow differs between two HostFlows.
+type DiffType int
+
+const (
+	// DiffNew are the host flows that appeared.
+	DiffNew DiffType = iota
+	// DiffGone are the host flows that disappeared.
+	DiffGone
+	// DiffChanged are the host flows whose traffic changed.
+	DiffChanged
+)
+
+// String returns the string representation of the DiffType.
+func (t DiffType) String() string {
+	switch t {
+	case DiffNew:
+		return "new"
+	case DiffGone:
+		return "gone"
+	case DiffChanged:
+		return "changed"
+	}
+	return "unknown"
+}
+
+// MarshalJSON returns human readable `change` format.
+func (t DiffType) MarshalJSON() ([]byte, error) {
+	switch t {
+	case DiffNew, DiffGone, DiffChanged:
+		return json.Marshal(t.String())
+	}
+	return nil, errors.New("unreachable code")
+}
+
+// FlowDiff represents the difference of a host flow.
+// Old are nil on DiffNew and New are nil on DiffGone.
+type FlowDiff struct {
+	Type DiffType      `json:"change"`
+	Flow *HostFlow     `json:"flow"`
+	Old  *HostFlowStat `json:"old_stat"`
+	New  *HostFlowStat `json:"new_stat"`
+}
+
+// Diff returns the host flows that are new in newer, gone from older, or whose
+// bytes or connections changed by more than threshold percent, sorted by the unique key.
+func Diff(older, newer HostFlows, threshold float64) []*FlowDiff {
+	diffs := []*FlowDiff{}
+	for key, flow := range newer {
+		old, ok := older[key]
+		if !ok {
+			diffs = append(diffs, &FlowDiff{Type: DiffNew, Flow: flow, New: flow.Stat})
+			continue
+		}
+		bytes := changeRate(old.Stat.totalBytes(), flow.Stat.totalBytes())
+		conns := changeRate(old.Stat.TotalConnections, flow.Stat.TotalConnections)
+		if bytes > threshold || conns > threshold {
+			diffs = append(diffs, &FlowDiff{Type: DiffChanged, Flow: flow, Old: old.Stat, New: flow.Stat})
+		}
+	}
+	for key, flow := range older {
+		if _, ok := newer[key]; !ok {
+			diffs = append(diffs, &FlowDiff{Type: DiffGone, Flow: flow, Old: flow.Stat})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Flow.UniqKey() < diffs[j].Flow.UniqKey()
+	})
+	return diffs
+}
+
+// totalBytes returns the sum of the inbound and outbound bytes.
+func (s *HostFlowStat) totalBytes() int64 {
+	return s.TotalInboundBytes + s.TotalOutboundBytes
+}
+
+// changeRate returns the absolute change from old to new in percent.
+func changeRate(old, new int64) float64 {
+	if old == 0 {
+		if new == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return math.Abs(float64(new-old)) / float64(old) * 100
+}
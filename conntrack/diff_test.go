@@ -0,0 +1,106 @@
+package conntrack
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newTestFlow(direction FlowDirection, peer, port string, bytes, conns int64) *HostFlow {
+	local := &AddrPort{Addr: "localhost", Port: "many"}
+	remote := &AddrPort{Addr: peer, Port: port}
+	if direction == FlowPassive {
+		local = &AddrPort{Addr: "localhost", Port: port}
+		remote = &AddrPort{Addr: peer, Port: "many"}
+	}
+	return &HostFlow{
+		Direction: direction,
+		Local:     local,
+		Peer:      remote,
+		Stat:      &HostFlowStat{TotalInboundBytes: bytes, TotalConnections: conns},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	older, newer := HostFlows{}, HostFlows{}
+	older.insert(newTestFlow(FlowActive, "10.0.1.10", "3306", 1000, 10))
+	older.insert(newTestFlow(FlowActive, "10.0.1.11", "6379", 1000, 10))
+	older.insert(newTestFlow(FlowPassive, "10.0.2.10", "80", 1000, 10))
+	newer.insert(newTestFlow(FlowActive, "10.0.1.10", "3306", 1400, 10))
+	newer.insert(newTestFlow(FlowPassive, "10.0.2.10", "80", 1000, 16))
+	newer.insert(newTestFlow(FlowActive, "10.0.1.12", "5432", 10, 1))
+
+	diffs := Diff(older, newer, 50)
+	expected := map[string]DiffType{
+		"2-localhost:many-10.0.1.11:6379": DiffGone,
+		"2-localhost:many-10.0.1.12:5432": DiffNew,
+		"4-localhost:80-10.0.2.10:many":   DiffChanged,
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("diffs should be %d, not %d", len(expected), len(diffs))
+	}
+	for _, d := range diffs {
+		if typ, ok := expected[d.Flow.UniqKey()]; !ok || typ != d.Type {
+			t.Errorf("unexpected diff: %q %v", d.Flow.UniqKey(), d.Type)
+		}
+	}
+
+	if diffs := Diff(older, older, 0); len(diffs) != 0 {
+		t.Errorf("diffs of the same flows should be empty, not %d", len(diffs))
+	}
+}
+
+func TestDiff_resolved(t *testing.T) {
+	numerical := HostFlows{}
+	numerical.insert(newTestFlow(FlowActive, "10.0.1.10", "3306", 1000, 10))
+	numerical.insert(newTestFlow(FlowActive, "10.0.1.11", "3306", 1000, 10))
+	numerical.insert(newTestFlow(FlowPassive, "10.0.2.10", "80", 1000, 10))
+	// the two peers are resolved into the same name.
+	resolved := numerical.Resolved(func(addr string) string {
+		if strings.HasPrefix(addr, "10.0.1.") {
+			return "db.example.com"
+		}
+		return addr
+	})
+	b, err := json.Marshal(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	older, err := ReadHostFlows(strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := Diff(older, numerical, 0); len(diffs) != 0 {
+		t.Errorf("the flows resolved into the names should be compared by the addresses, not %d diffs", len(diffs))
+	}
+}
+
+func TestReadHostFlows(t *testing.T) {
+	flows := HostFlows{}
+	flows.insert(newTestFlow(FlowActive, "10.0.1.10", "3306", 1000, 10))
+	flows.insert(newTestFlow(FlowPassive, "10.0.2.10", "80", 1000, 10))
+	flows["4-localhost:80-10.0.2.10:many"].Reason = ReasonEphemeral
+	b, err := json.Marshal(flows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadHostFlows(strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatalf("ReadHostFlows should not return error: %v", err)
+	}
+	for key, flow := range flows {
+		f, ok := got[key]
+		if !ok {
+			t.Errorf("%q should be read", key)
+			continue
+		}
+		if f.Reason != flow.Reason || *f.Stat != *flow.Stat {
+			t.Errorf("%q should be %v %v, not %v %v", key, flow.Reason, flow.Stat, f.Reason, f.Stat)
+		}
+	}
+
+	if _, err := ReadHostFlows(strings.NewReader(`[{"direction": "sideways"}]`)); err == nil {
+		t.Error("ReadHostFlows should return error for the unknown direction")
+	}
+}
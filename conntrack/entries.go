@@ -0,0 +1,61 @@
+package conntrack
+
+import (
+	"bufio"
+	"io"
+	"net"
+)
+
+// Entries returns the conntrack entries aggregated into the host flow, such as the lines of
+// '/proc/net/nf_conntrack'. The entries are matched by the numerical endpoints of the flow
+// in either direction, regardless of the owners and the address translations.
+func Entries(r io.Reader, hf *HostFlow) ([]string, error) {
+	var entries []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		f, err := parseLine(line)
+		if err != nil || f == nil {
+			continue
+		}
+		if hf.matches(f) {
+			entries = append(entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// matches returns whether the entry is aggregated into the flow.
+func (hf *HostFlow) matches(f *flow) bool {
+	src := &AddrPort{Addr: f.originalSaddr, Port: f.originalSport}
+	dst := &AddrPort{Addr: f.originalDaddr, Port: f.originalDport}
+	switch hf.Direction {
+	case FlowActive:
+		return hf.Peer.matches(dst) || hf.Peer.matches(src)
+	case FlowPassive:
+		return (matchAddr(hf.Peer.Addr, src.Addr) && hf.Local.Port == dst.Port) ||
+			(matchAddr(hf.Peer.Addr, dst.Addr) && hf.Local.Port == src.Port)
+	case FlowForwarded:
+		return hf.Peer.matches(dst) && matchAddr(hf.Local.Addr, src.Addr)
+	}
+	return false
+}
+
+// matches returns whether the endpoint are aggregated into a.
+func (a *AddrPort) matches(e *AddrPort) bool {
+	return matchAddr(a.Addr, e.Addr) && (a.Port == "many" || a.Port == e.Port)
+}
+
+// matchAddr returns whether addr are aggregated into the address, the network or "many".
+func matchAddr(aggregated, addr string) bool {
+	if aggregated == "many" || aggregated == addr {
+		return true
+	}
+	if _, ipnet, err := net.ParseCIDR(aggregated); err == nil {
+		return containsAddr(ipnet, addr)
+	}
+	return false
+}
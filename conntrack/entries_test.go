@@ -0,0 +1,60 @@
+package conntrack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEntries(t *testing.T) {
+	lines := []string{
+		"tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+		"tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.1.10 sport=41144 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41144 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+		"tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=50000 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=50000 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+		"tcp      6 5 CLOSE src=10.0.3.10 dst=10.0.4.10 sport=50001 dport=443 packets=3 bytes=164 src=10.0.4.10 dst=10.0.3.10 sport=443 dport=50001 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+		"udp      17 5 src=10.0.0.10 dst=10.0.1.10 sport=53 dport=53",
+		"tcp      6 malformed",
+	}
+	tests := []struct {
+		desc     string
+		flow     *HostFlow
+		expected []string
+	}{
+		{
+			desc: "active",
+			flow: &HostFlow{
+				Direction: FlowActive,
+				Local:     &AddrPort{Addr: "localhost", Port: "many"},
+				Peer:      &AddrPort{Addr: "10.0.1.10", Port: "3306"},
+			},
+			expected: lines[0:2],
+		},
+		{
+			desc: "passive",
+			flow: &HostFlow{
+				Direction: FlowPassive,
+				Local:     &AddrPort{Addr: "localhost", Port: "80"},
+				Peer:      &AddrPort{Addr: "10.0.2.10", Port: "many"},
+			},
+			expected: lines[2:3],
+		},
+		{
+			desc: "forwarded from the aggregated clients",
+			flow: &HostFlow{
+				Direction: FlowForwarded,
+				Local:     &AddrPort{Addr: "10.0.3.0/24", Port: "many"},
+				Peer:      &AddrPort{Addr: "10.0.4.10", Port: "443"},
+			},
+			expected: lines[3:4],
+		},
+	}
+	for _, tc := range tests {
+		got, err := Entries(strings.NewReader(strings.Join(lines, "\n")), tc.flow)
+		if err != nil {
+			t.Fatalf("desc: %q, should not raise error: %v", tc.desc, err)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("desc: %q, entries should be %q, not %q", tc.desc, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package conntrack
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// Envelope are the host flows with the metadata of where and when they are collected.
+type Envelope struct {
+	Host        string    `json:"host"`
+	Addrs       []string  `json:"addrs"`
+	CollectedAt time.Time `json:"collected_at"`
+	Kernel      string    `json:"kernel"`
+	// Version are the version of lsconntrack.
+	Version string `json:"version"`
+	// Source are where the conntrack entries are read from, such as '/proc/net/nf_conntrack'.
+	Source string `json:"source"`
+	// ParseErrors are the number of the malformed conntrack entries skipped.
+	ParseErrors int       `json:"parse_errors"`
+	Flows       HostFlows `json:"flows"`
+}
+
+// UnmarshalJSON parses the list formats returned by MarshalJSON.
+func (hf *HostFlows) UnmarshalJSON(b []byte) error {
+	var list []*HostFlow
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	flows := HostFlows{}
+	for _, flow := range list {
+		if flow.Local == nil || flow.Peer == nil || flow.Stat == nil {
+			return errors.New("host flow without local, peer or stat")
+		}
+		flows.insert(flow)
+	}
+	*hf = flows
+	return nil
+}
+
+// ReadEnvelope reads the host flows printed as json format, either the envelope
+// or the bare list. The envelope of the bare list has only Flows.
+func ReadEnvelope(r io.Reader) (*Envelope, error) {
+	br := bufio.NewReader(r)
+	var env Envelope
+	for {
+		c, _, err := br.ReadRune()
+		if err != nil {
+			return nil, err
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			continue
+		}
+		br.UnreadRune()
+		if c == '[' {
+			if err := json.NewDecoder(br).Decode(&env.Flows); err != nil {
+				return nil, err
+			}
+			return &env, nil
+		}
+		break
+	}
+	if err := json.NewDecoder(br).Decode(&env); err != nil {
+		return nil, err
+	}
+	if env.Flows == nil {
+		return nil, errors.New("no flows in the envelope")
+	}
+	return &env, nil
+}
@@ -0,0 +1,58 @@
+package conntrack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadEnvelope(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		host  string
+		flows int
+	}{
+		{
+			desc:  "bare list",
+			input: ` [{"direction":"active","local":{"addr":"localhost","port":"many"},"peer":{"addr":"10.0.1.10","port":"3306"},"stat":{}}]`,
+			flows: 1,
+		},
+		{
+			desc: "envelope",
+			input: `{"host":"web01","addrs":["10.0.0.10"],"collected_at":"2018-01-01T00:00:00Z","parse_errors":0,"flows":[
+{"direction":"active","local":{"addr":"localhost","port":"many"},"peer":{"addr":"10.0.1.10","port":"3306"},"stat":{}},
+{"direction":"passive","local":{"addr":"localhost","port":"80"},"peer":{"addr":"10.0.2.10","port":"many"},"stat":{}}]}`,
+			host:  "web01",
+			flows: 2,
+		},
+	}
+	for _, tc := range tests {
+		env, err := ReadEnvelope(strings.NewReader(tc.input))
+		if err != nil {
+			t.Fatalf("desc: %q, ReadEnvelope should not return error: %v", tc.desc, err)
+		}
+		if env.Host != tc.host || len(env.Flows) != tc.flows {
+			t.Errorf("desc: %q, envelope should be %q with %d flows, not %q with %d flows", tc.desc, tc.host, tc.flows, env.Host, len(env.Flows))
+		}
+	}
+
+	if _, err := ReadEnvelope(strings.NewReader(`{"version": 1}`)); err == nil {
+		t.Error("ReadEnvelope should return error without flows")
+	}
+}
+
+func TestParseEntries_malformed(t *testing.T) {
+	local, _ := NewLocalAddrs([]string{"10.0.0.10"})
+	entries := `tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1
+
+tcp      6 5 CLOSE src=10.0.0.10 [ASSURED]
+udp      17 29 src=10.0.0.10 dst=10.0.0.2 sport=53242 dport=53 src=10.0.0.2 dst=10.0.0.10 sport=53 dport=53242 mark=0 use=1
+`
+	flows, malformed, err := ParseEntries(strings.NewReader(entries), local, FilterPorts{}, nil)
+	if err != nil {
+		t.Fatalf("ParseEntries should not return error: %v", err)
+	}
+	if len(flows) != 1 || malformed != 1 {
+		t.Errorf("ParseEntries should return 1 flow and 1 malformed entry, not %d and %d", len(flows), malformed)
+	}
+}
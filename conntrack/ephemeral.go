@@ -0,0 +1,92 @@
+package conntrack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DirectionReason represents how the direction of a host flow is determined.
+type DirectionReason int
+
+const (
+	// ReasonOriginal are determined by the original direction of the connection tracked by conntrack.
+	ReasonOriginal DirectionReason = iota
+	// ReasonListening are determined by the local listening ports.
+	ReasonListening
+	// ReasonEphemeral are guessed by the ephemeral port range since the local port is not known to be listened.
+	ReasonEphemeral
+)
+
+// Guessed returns whether the direction is a guess.
+func (r DirectionReason) Guessed() bool {
+	return r == ReasonEphemeral
+}
+
+// String returns the string representation of the DirectionReason.
+func (r DirectionReason) String() string {
+	switch r {
+	case ReasonOriginal:
+		return "original"
+	case ReasonListening:
+		return "listening"
+	case ReasonEphemeral:
+		return "ephemeral"
+	}
+	return ""
+}
+
+// MarshalJSON returns human readable `reason` format.
+func (r DirectionReason) MarshalJSON() ([]byte, error) {
+	switch r {
+	case ReasonOriginal, ReasonListening, ReasonEphemeral:
+		return json.Marshal(r.String())
+	}
+	return nil, errors.New("unreachable code")
+}
+
+// UnmarshalJSON parses the `reason` format returned by MarshalJSON.
+func (r *DirectionReason) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	for _, reason := range []DirectionReason{ReasonOriginal, ReasonListening, ReasonEphemeral} {
+		if s == reason.String() {
+			*r = reason
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown direction reason %q", s)
+}
+
+// endpointsByEphemeral guesses the endpoints of the connection to the local address
+// by which side uses the ephemeral port: the other side are the service port.
+// It returns nil if both or neither sides use the ephemeral port.
+func (f *flow) endpointsByEphemeral(local LocalAddrs, fports FilterPorts) *endpoints {
+	var e *endpoints
+	switch {
+	case local.Contains(f.originalDaddr):
+		e = &endpoints{laddr: f.originalDaddr, lport: f.originalDport, paddr: f.originalSaddr, pport: f.originalSport}
+	case local.Contains(f.replySaddr):
+		e = &endpoints{laddr: f.replySaddr, lport: f.replySport, paddr: f.replyDaddr, pport: f.replyDport}
+	default:
+		return nil
+	}
+	e.reason = ReasonEphemeral
+	localEphemeral := fports.Ephemeral.Contains(e.lport)
+	peerEphemeral := fports.Ephemeral.Contains(e.pport)
+	switch {
+	case !localEphemeral && peerEphemeral:
+		e.direction = FlowPassive
+	case localEphemeral && !peerEphemeral:
+		// the connection from localhost has been tracked in reverse, such as after conntrack was flushed.
+		if len(fports.Active) > 0 && !contains(fports.Active, e.pport) {
+			return nil
+		}
+		e.direction = FlowActive
+	default:
+		return nil
+	}
+	return e
+}
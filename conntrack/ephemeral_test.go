@@ -0,0 +1,63 @@
+package conntrack
+
+import (
+	"testing"
+
+	"github.com/yuuki/lsconntrack/netutil"
+)
+
+func TestToHostFlow_ephemeral(t *testing.T) {
+	local, _ := NewLocalAddrs([]string{"10.0.0.10"})
+	fports := FilterPorts{
+		Passive:   []string{"80"},
+		Ephemeral: &netutil.PortRange{Min: 32768, Max: 60999},
+	}
+	tests := []struct {
+		desc      string
+		line      string
+		direction FlowDirection
+		reason    DirectionReason
+		key       string
+	}{
+		{
+			desc:      "listening",
+			line:      "tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			direction: FlowPassive,
+			reason:    ReasonListening,
+			key:       "4-localhost:80-10.0.2.10:many",
+		},
+		{
+			desc:      "not listening service port",
+			line:      "tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=8080 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=8080 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			direction: FlowPassive,
+			reason:    ReasonEphemeral,
+			key:       "4-localhost:8080-10.0.2.10:many",
+		},
+		{
+			desc:      "tracked in reverse",
+			line:      "tcp      6 5 CLOSE src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=3 bytes=164 src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			direction: FlowActive,
+			reason:    ReasonEphemeral,
+			key:       "2-localhost:many-10.0.1.10:3306",
+		},
+		{
+			desc: "both ephemeral",
+			line: "tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=41144 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=41144 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+		},
+	}
+	for _, tc := range tests {
+		hf := mustParseLine(t, tc.line).toHostFlow(local, fports, nil)
+		if tc.key == "" {
+			if hf != nil {
+				t.Errorf("desc: %q, toHostFlow should be nil, not %v", tc.desc, hf)
+			}
+			continue
+		}
+		if hf == nil {
+			t.Fatalf("desc: %q, toHostFlow should not be nil", tc.desc)
+		}
+		if hf.Direction != tc.direction || hf.Reason != tc.reason || hf.UniqKey() != tc.key {
+			t.Errorf("desc: %q, flow should be %v %v %q, not %v %v %q", tc.desc, tc.direction, tc.reason, tc.key, hf.Direction, hf.Reason, hf.UniqKey())
+		}
+	}
+}
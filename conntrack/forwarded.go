@@ -0,0 +1,91 @@
+package conntrack
+
+import (
+	"bufio"
+	"io"
+	"net"
+)
+
+// ForwardedOptions are the options to aggregate forwarded flows.
+type ForwardedOptions struct {
+	// ServerPorts are the server ports to filter output. All ports are printed if empty.
+	ServerPorts []string
+	// ClientCIDRs aggregates the clients in each network into the network.
+	ClientCIDRs []*net.IPNet
+	// ByServer aggregates the flows by the server address and port regardless of the clients.
+	ByServer bool
+}
+
+// client returns the client address aggregated by opts.
+func (opts *ForwardedOptions) client(addr string) string {
+	if opts.ByServer {
+		return "many"
+	}
+	ip := net.ParseIP(addr)
+	for _, cidr := range opts.ClientCIDRs {
+		if ip != nil && cidr.Contains(ip) {
+			return cidr.String()
+		}
+	}
+	return addr
+}
+
+// toForwardedFlow converts into HostFlow whose Local are the client and Peer are the server
+// if neither the client nor the server is local, which means the host forwards the connection.
+func (f *flow) toForwardedFlow(local LocalAddrs, opts *ForwardedOptions) *HostFlow {
+	// The reply destination is not checked since it is the host itself on masquerade,
+	// and the original destination is not checked if it is translated into the real server,
+	// such as a virtual IP or the gateway address of the host on DNAT.
+	dnat := f.replySaddr != f.originalDaddr
+	if local.Contains(f.originalSaddr) || local.Contains(f.replySaddr) || (!dnat && local.Contains(f.originalDaddr)) {
+		return nil
+	}
+	if len(opts.ServerPorts) > 0 && !contains(opts.ServerPorts, f.originalDport) {
+		return nil
+	}
+	client := opts.client(f.originalSaddr)
+	nat := f.nat()
+	if nat != nil && nat.SNAT != nil {
+		nat.SNAT.Pre.Addr = client // not to split the aggregated clients
+	}
+	return &HostFlow{
+		Direction: FlowForwarded,
+		Local:     &AddrPort{Addr: client, Port: "many"},
+		Peer:      &AddrPort{Addr: f.originalDaddr, Port: f.originalDport},
+		NAT:       nat,
+		Stat:      newEntryStat(f.tuple(), f.replyPackets, f.replyBytes, f.originalPackets, f.originalBytes),
+	}
+}
+
+// ParseForwardedEntries parses '/proc/net/nf_conntrack or /proc/net/ip_conntrack'
+// into the flows forwarded by the host such as a NAT gateway or a load balancer.
+// The addresses of the host interfaces are regarded as local if local is nil.
+// It skips the malformed entries and returns the number of them.
+func ParseForwardedEntries(r io.Reader, local LocalAddrs, opts *ForwardedOptions) (HostFlows, int, error) {
+	local, err := defaultLocalAddrs(local)
+	if err != nil {
+		return nil, 0, err
+	}
+	hostFlows := HostFlows{}
+	var malformed int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		flow, err := parseLine(scanner.Text())
+		if err != nil {
+			malformed++
+			continue
+		}
+		if flow == nil {
+			continue
+		}
+		hostFlow := flow.toForwardedFlow(local, opts)
+		if hostFlow == nil {
+			continue
+		}
+		hostFlows.insert(hostFlow)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, malformed, err
+	}
+	return hostFlows, malformed, nil
+}
@@ -0,0 +1,90 @@
+package conntrack
+
+import (
+	"net"
+	"testing"
+)
+
+func TestToForwardedFlow(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.0.0/24")
+	local, _ := NewLocalAddrs([]string{"192.168.0.1", "203.0.113.1"})
+	tests := []struct {
+		desc  string
+		line  string
+		opts  *ForwardedOptions
+		local *AddrPort
+		peer  *AddrPort
+		nat   string
+	}{
+		{
+			desc:  "masquerade",
+			line:  "tcp      6 86399 ESTABLISHED src=192.168.0.5 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=203.0.113.1 sport=3306 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			opts:  &ForwardedOptions{},
+			local: &AddrPort{Addr: "192.168.0.5", Port: "many"},
+			peer:  &AddrPort{Addr: "10.0.1.10", Port: "3306"},
+		},
+		{
+			desc:  "client cidr",
+			line:  "tcp      6 86399 ESTABLISHED src=192.168.0.5 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=203.0.113.1 sport=3306 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			opts:  &ForwardedOptions{ClientCIDRs: []*net.IPNet{lan}},
+			local: &AddrPort{Addr: "192.168.0.0/24", Port: "many"},
+			peer:  &AddrPort{Addr: "10.0.1.10", Port: "3306"},
+		},
+		{
+			desc:  "by server",
+			line:  "tcp      6 86399 ESTABLISHED src=192.168.0.5 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=203.0.113.1 sport=3306 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			opts:  &ForwardedOptions{ByServer: true},
+			local: &AddrPort{Addr: "many", Port: "many"},
+			peer:  &AddrPort{Addr: "10.0.1.10", Port: "3306"},
+		},
+		{
+			desc: "filtered by server port",
+			line: "tcp      6 86399 ESTABLISHED src=192.168.0.5 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=203.0.113.1 sport=3306 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			opts: &ForwardedOptions{ServerPorts: []string{"80"}},
+		},
+		{
+			desc:  "dnat to the virtual IP of localhost",
+			line:  "tcp      6 86399 ESTABLISHED src=198.51.100.7 dst=203.0.113.1 sport=41143 dport=80 packets=3 bytes=164 src=10.0.1.10 dst=198.51.100.7 sport=8080 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			opts:  &ForwardedOptions{},
+			local: &AddrPort{Addr: "198.51.100.7", Port: "many"},
+			peer:  &AddrPort{Addr: "203.0.113.1", Port: "80"},
+			nat:   "dnat 203.0.113.1:80->10.0.1.10:8080",
+		},
+		{
+			desc: "passive open to localhost",
+			line: "tcp      6 86399 ESTABLISHED src=198.51.100.7 dst=203.0.113.1 sport=41143 dport=80 packets=3 bytes=164 src=203.0.113.1 dst=198.51.100.7 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			opts: &ForwardedOptions{},
+		},
+		{
+			desc: "redirect to localhost",
+			line: "tcp      6 86399 ESTABLISHED src=198.51.100.7 dst=203.0.113.1 sport=41143 dport=80 packets=3 bytes=164 src=203.0.113.1 dst=198.51.100.7 sport=8080 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			opts: &ForwardedOptions{},
+		},
+		{
+			desc: "active open from localhost",
+			line: "tcp      6 86399 ESTABLISHED src=192.168.0.1 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=192.168.0.1 sport=3306 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			opts: &ForwardedOptions{},
+		},
+	}
+	for _, tc := range tests {
+		hf := mustParseLine(t, tc.line).toForwardedFlow(local, tc.opts)
+		if tc.local == nil {
+			if hf != nil {
+				t.Errorf("desc: %q, toForwardedFlow should be nil, not %v", tc.desc, hf)
+			}
+			continue
+		}
+		if hf == nil {
+			t.Fatalf("desc: %q, toForwardedFlow should not be nil", tc.desc)
+		}
+		if *hf.Local != *tc.local {
+			t.Errorf("desc: %q, local should be %v, not %v", tc.desc, tc.local, hf.Local)
+		}
+		if *hf.Peer != *tc.peer {
+			t.Errorf("desc: %q, peer should be %v, not %v", tc.desc, tc.peer, hf.Peer)
+		}
+		if tc.nat != "" && hf.NAT.String() != tc.nat {
+			t.Errorf("desc: %q, nat should be %q, not %q", tc.desc, tc.nat, hf.NAT)
+		}
+	}
+}
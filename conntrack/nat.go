@@ -0,0 +1,129 @@
+package conntrack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// NATType are bitmask that represents the address translations applied to a connection.
+type NATType int
+
+const (
+	// NATNone are no translation.
+	NATNone NATType = 0
+	// NATSource are source NAT such as SNAT and MASQUERADE.
+	NATSource NATType = 1 << iota
+	// NATDestination are destination NAT such as DNAT and REDIRECT.
+	NATDestination
+	// NATBoth are both source and destination NAT.
+	NATBoth = NATSource | NATDestination
+)
+
+// String returns the string representation of the NATType.
+func (t NATType) String() string {
+	switch t {
+	case NATNone:
+		return "none"
+	case NATSource:
+		return "snat"
+	case NATDestination:
+		return "dnat"
+	case NATBoth:
+		return "both"
+	}
+	return "unknown"
+}
+
+// MarshalJSON returns human readable `nat` format.
+func (t NATType) MarshalJSON() ([]byte, error) {
+	switch t {
+	case NATNone, NATSource, NATDestination, NATBoth:
+		return json.Marshal(t.String())
+	}
+	return nil, errors.New("unreachable code")
+}
+
+// UnmarshalJSON parses the `nat` format returned by MarshalJSON.
+func (t *NATType) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	for _, typ := range []NATType{NATNone, NATSource, NATDestination, NATBoth} {
+		if s == typ.String() {
+			*t = typ
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown nat type %q", s)
+}
+
+// Translation represents the endpoint before and after an address translation.
+type Translation struct {
+	Pre  *AddrPort `json:"pre"`
+	Post *AddrPort `json:"post"`
+}
+
+// NAT represents the address translations of a host flow.
+type NAT struct {
+	Type NATType `json:"type"`
+	// SNAT are the translation of the connection source, which has no port to aggregate.
+	SNAT *Translation `json:"snat,omitempty"`
+	// DNAT are the translation of the connection destination,
+	// such as from a ClusterIP or a virtual IP into the real backend.
+	DNAT *Translation `json:"dnat,omitempty"`
+}
+
+// String returns the string representation of the NAT.
+// eg. dnat 10.96.0.10:80->10.244.1.5:8080
+func (n *NAT) String() string {
+	if n == nil {
+		return NATNone.String()
+	}
+	parts := make([]string, 0, 2)
+	if n.SNAT != nil {
+		parts = append(parts, fmt.Sprintf("snat %s->%s", n.SNAT.Pre.Addr, n.SNAT.Post.Addr))
+	}
+	if n.DNAT != nil {
+		parts = append(parts, fmt.Sprintf("dnat %s->%s", n.DNAT.Pre, n.DNAT.Post))
+	}
+	return strings.Join(parts, " ")
+}
+
+// numerical returns n itself, or the copy of n whose DNAT backend are turned back into the numerical address if replaced into the name.
+func (n *NAT) numerical() *NAT {
+	if n.DNAT == nil || n.DNAT.Post.IP == "" {
+		return n
+	}
+	c, dnat := *n, *n.DNAT
+	dnat.Post = dnat.Post.numerical()
+	c.DNAT = &dnat
+	return &c
+}
+
+// nat returns the address translations detected by the difference between
+// the original and reply tuples, or nil if the connection is not translated.
+func (f *flow) nat() *NAT {
+	n := &NAT{}
+	if f.replySaddr != f.originalDaddr || f.replySport != f.originalDport {
+		n.Type |= NATDestination
+		n.DNAT = &Translation{
+			Pre:  &AddrPort{Addr: f.originalDaddr, Port: f.originalDport},
+			Post: &AddrPort{Addr: f.replySaddr, Port: f.replySport},
+		}
+	}
+	// only the address is compared since the source port is ephemeral.
+	if f.replyDaddr != f.originalSaddr {
+		n.Type |= NATSource
+		n.SNAT = &Translation{
+			Pre:  &AddrPort{Addr: f.originalSaddr, Port: "many"},
+			Post: &AddrPort{Addr: f.replyDaddr, Port: "many"},
+		}
+	}
+	if n.Type == NATNone {
+		return nil
+	}
+	return n
+}
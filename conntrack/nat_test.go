@@ -0,0 +1,50 @@
+package conntrack
+
+import "testing"
+
+func TestFlowNAT(t *testing.T) {
+	tests := []struct {
+		desc string
+		line string
+		typ  NATType
+		str  string
+	}{
+		{
+			desc: "none",
+			line: "tcp      6 5 CLOSE src=10.0.0.10 dst=10.0.0.11 sport=41143 dport=443 packets=3 bytes=164 src=10.0.0.11 dst=10.0.0.10 sport=443 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			typ:  NATNone,
+			str:  "none",
+		},
+		{
+			desc: "dnat to ClusterIP backend",
+			line: "tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.96.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.244.1.5 dst=10.0.0.10 sport=8080 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			typ:  NATDestination,
+			str:  "dnat 10.96.0.10:80->10.244.1.5:8080",
+		},
+		{
+			desc: "snat",
+			line: "tcp      6 86399 ESTABLISHED src=172.17.0.2 dst=10.0.1.10 sport=41143 dport=3306 packets=3 bytes=164 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=61000 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			typ:  NATSource,
+			str:  "snat 172.17.0.2->10.0.0.10",
+		},
+		{
+			desc: "both",
+			line: "tcp      6 86399 ESTABLISHED src=192.168.0.5 dst=203.0.113.1 sport=41143 dport=80 packets=3 bytes=164 src=10.0.2.10 dst=10.0.0.1 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1",
+			typ:  NATBoth,
+			str:  "snat 192.168.0.5->10.0.0.1 dnat 203.0.113.1:80->10.0.2.10:80",
+		},
+	}
+	for _, tc := range tests {
+		n := mustParseLine(t, tc.line).nat()
+		typ := NATNone
+		if n != nil {
+			typ = n.Type
+		}
+		if typ != tc.typ {
+			t.Errorf("desc: %q, type should be %v, not %v", tc.desc, tc.typ, typ)
+		}
+		if n.String() != tc.str {
+			t.Errorf("desc: %q, string should be %q, not %q", tc.desc, tc.str, n.String())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package conntrack
+
+import (
+	"sort"
+	"time"
+)
+
+// Seen are when the host flow is seen first and last across the rounds, and its totals while seen.
+type Seen struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Totals are the packets and bytes accumulated over the rounds, including those of the closed connections,
+	// and the peak number of the connections.
+	Totals *HostFlowStat `json:"totals"`
+}
+
+// Tracker remembers the host flows seen across the rounds by the unique key.
+type Tracker struct {
+	seen  map[string]*Seen
+	last  map[string]*HostFlow
+	stats map[string]*HostFlowStat
+}
+
+// NewTracker returns the tracker that has seen nothing.
+func NewTracker() *Tracker {
+	return &Tracker{
+		seen:  map[string]*Seen{},
+		last:  map[string]*HostFlow{},
+		stats: map[string]*HostFlowStat{},
+	}
+}
+
+// Observe remembers the flows seen at the time, and sets Seen of the flows.
+// The counters of the flows seen in the previous round are accumulated by the deltas since then.
+func (t *Tracker) Observe(flows HostFlows, at time.Time) {
+	current := make(map[string]*HostFlowStat, len(flows))
+	for key, flow := range flows {
+		s, ok := t.seen[key]
+		if !ok {
+			s = &Seen{FirstSeen: at, Totals: &HostFlowStat{}}
+			t.seen[key] = s
+		}
+		d := flow.Stat.Sub(t.stats[key])
+		s.LastSeen = at
+		s.Totals.TotalInboundPackets += d.TotalInboundPackets
+		s.Totals.TotalInboundBytes += d.TotalInboundBytes
+		s.Totals.TotalOutboundPackets += d.TotalOutboundPackets
+		s.Totals.TotalOutboundBytes += d.TotalOutboundBytes
+		if flow.Stat.TotalConnections > s.Totals.TotalConnections {
+			s.Totals.TotalConnections = flow.Stat.TotalConnections
+		}
+		flow.Seen = s
+		t.last[key] = flow
+		current[key] = flow.Stat
+	}
+	// the flows gone in the round are counted from 0 when they are seen again.
+	t.stats = current
+}
+
+// Restore remembers the flows seen before, such as those stored by the previous run, as if they were observed
+// in the last round. The flows without Seen are ignored.
+func (t *Tracker) Restore(flows HostFlows) {
+	for key, flow := range flows {
+		if flow.Seen == nil {
+			continue
+		}
+		t.seen[key] = flow.Seen
+		t.last[key] = flow
+		t.stats[key] = flow.Stat
+	}
+}
+
+// Stale returns the flows seen last before the time, sorted by the last seen time.
+func (t *Tracker) Stale(before time.Time) []*HostFlow {
+	var stale []*HostFlow
+	for key, flow := range t.last {
+		if t.seen[key].LastSeen.Before(before) {
+			stale = append(stale, flow)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		if !stale[i].Seen.LastSeen.Equal(stale[j].Seen.LastSeen) {
+			return stale[i].Seen.LastSeen.Before(stale[j].Seen.LastSeen)
+		}
+		return stale[i].UniqKey() < stale[j].UniqKey()
+	})
+	return stale
+}
@@ -0,0 +1,93 @@
+package conntrack
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	flow := func(peer string, bytes, conns int64) HostFlows {
+		f := &HostFlow{
+			Direction: FlowActive,
+			Local:     &AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &AddrPort{Addr: peer, Port: "3306"},
+			Stat:      &HostFlowStat{TotalInboundBytes: bytes, TotalConnections: conns},
+		}
+		return HostFlows{f.UniqKey(): f}
+	}
+	rounds := []HostFlows{
+		flow("10.0.1.10", 100, 1),
+		flow("10.0.1.10", 300, 3),
+		flow("10.0.1.11", 50, 1), // 10.0.1.10 is gone
+		flow("10.0.1.10", 40, 1), // 10.0.1.10 is seen again with the new connection
+	}
+	tracker := NewTracker()
+	for i, flows := range rounds {
+		tracker.Observe(flows, at.Add(time.Duration(i)*time.Hour))
+	}
+
+	tests := []struct {
+		desc      string
+		flows     HostFlows
+		firstSeen time.Time
+		lastSeen  time.Time
+		totals    HostFlowStat
+	}{
+		{
+			desc:      "seen again",
+			flows:     rounds[3],
+			firstSeen: at,
+			lastSeen:  at.Add(3 * time.Hour),
+			totals:    HostFlowStat{TotalInboundBytes: 340, TotalConnections: 3},
+		},
+		{
+			desc:      "seen once",
+			flows:     rounds[2],
+			firstSeen: at.Add(2 * time.Hour),
+			lastSeen:  at.Add(2 * time.Hour),
+			totals:    HostFlowStat{TotalInboundBytes: 50, TotalConnections: 1},
+		},
+	}
+	for _, tc := range tests {
+		for _, f := range tc.flows {
+			if f.Seen == nil {
+				t.Fatalf("desc: %q, Seen should be set", tc.desc)
+			}
+			if !f.Seen.FirstSeen.Equal(tc.firstSeen) || !f.Seen.LastSeen.Equal(tc.lastSeen) {
+				t.Errorf("desc: %q, seen should be %v - %v, not %v - %v", tc.desc, tc.firstSeen, tc.lastSeen, f.Seen.FirstSeen, f.Seen.LastSeen)
+			}
+			if *f.Seen.Totals != tc.totals {
+				t.Errorf("desc: %q, totals should be %v, not %v", tc.desc, tc.totals, *f.Seen.Totals)
+			}
+		}
+	}
+
+	stale := tracker.Stale(at.Add(3 * time.Hour))
+	if len(stale) != 1 || stale[0].Peer.Addr != "10.0.1.11" {
+		t.Errorf("the stale flow should be only 10.0.1.11, not %v", stale)
+	}
+}
+
+func TestTracker_Restore(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	flow := &HostFlow{
+		Direction: FlowActive,
+		Local:     &AddrPort{Addr: "localhost", Port: "many"},
+		Peer:      &AddrPort{Addr: "10.0.1.10", Port: "3306"},
+		Stat:      &HostFlowStat{TotalInboundBytes: 100, TotalConnections: 1},
+		Seen:      &Seen{FirstSeen: at, LastSeen: at, Totals: &HostFlowStat{TotalInboundBytes: 100, TotalConnections: 1}},
+	}
+	tracker := NewTracker()
+	tracker.Restore(HostFlows{flow.UniqKey(): flow})
+
+	next := *flow
+	next.Stat, next.Seen = &HostFlowStat{TotalInboundBytes: 250, TotalConnections: 1}, nil
+	tracker.Observe(HostFlows{next.UniqKey(): &next}, at.Add(time.Hour))
+	if !next.Seen.FirstSeen.Equal(at) {
+		t.Errorf("the first seen should be restored %v, not %v", at, next.Seen.FirstSeen)
+	}
+	if next.Seen.Totals.TotalInboundBytes != 250 {
+		t.Errorf("the totals should be accumulated from the restored stat to 250, not %d", next.Seen.Totals.TotalInboundBytes)
+	}
+}
@@ -1,5 +1,7 @@
 package conntrack
 
+import "net"
+
 func contains(strs []string, s string) bool {
 	for _, str := range strs {
 		if str == s {
@@ -8,3 +10,8 @@ func contains(strs []string, s string) bool {
 	}
 	return false
 }
+
+func containsAddr(ipnet *net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ipnet.Contains(ip)
+}
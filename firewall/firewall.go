@@ -0,0 +1,221 @@
+package firewall
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+// Rule allows the connections on the port from or to the networks.
+// The port are the local listening port on FlowPassive (ingress)
+// and the peer port on FlowActive (egress).
+type Rule struct {
+	Direction conntrack.FlowDirection
+	Port      string
+	Nets      []*net.IPNet
+}
+
+// Rules returns the allowlist rules of the active and passive flows.
+// The IPv4 peers are rolled up into the networks of prefix bits at most,
+// and the adjacent networks are merged.
+func Rules(flows conntrack.HostFlows, prefix int) []*Rule {
+	type key struct {
+		direction conntrack.FlowDirection
+		port      string
+	}
+	peers := map[key][]net.IP{}
+	for _, flow := range flows {
+		var k key
+		switch flow.Direction {
+		case conntrack.FlowActive:
+			k = key{flow.Direction, flow.Peer.Port}
+		case conntrack.FlowPassive:
+			k = key{flow.Direction, flow.Local.Port}
+		default:
+			continue
+		}
+		ip := net.ParseIP(flow.Peer.Addr)
+		if ip == nil {
+			continue // the name resolved or the aggregated peers
+		}
+		peers[k] = append(peers[k], ip)
+	}
+	rules := make([]*Rule, 0, len(peers))
+	for k, ips := range peers {
+		rules = append(rules, &Rule{Direction: k.direction, Port: k.port, Nets: rollUp(ips, prefix)})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Direction != rules[j].Direction {
+			return rules[i].Direction > rules[j].Direction // passive first
+		}
+		pi, _ := strconv.Atoi(rules[i].Port)
+		pj, _ := strconv.Atoi(rules[j].Port)
+		return pi < pj
+	})
+	return rules
+}
+
+// block are the IPv4 network.
+type block struct {
+	base uint32
+	bits int
+}
+
+func (b block) size() uint32 {
+	return 1 << uint(32-b.bits)
+}
+
+func (b block) contains(o block) bool {
+	return uint64(o.base) >= uint64(b.base) && uint64(o.base) < uint64(b.base)+uint64(1)<<uint(32-b.bits)
+}
+
+// rollUp returns the networks of the addresses.
+// The IPv4 addresses are masked by prefix bits and the sibling networks are merged.
+// The IPv6 addresses are returned as they are.
+func rollUp(ips []net.IP, prefix int) []*net.IPNet {
+	if prefix < 0 || prefix > 32 {
+		prefix = 32
+	}
+	mask := net.CIDRMask(prefix, 32)
+	blocks := []block{}
+	nets := []*net.IPNet{}
+	seen := map[string]bool{}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			blocks = append(blocks, block{binary.BigEndian.Uint32(ip4.Mask(mask)), prefix})
+			continue
+		}
+		if !seen[ip.String()] {
+			seen[ip.String()] = true
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].base < blocks[j].base })
+
+	stack := []block{}
+	for _, b := range blocks {
+		if n := len(stack); n > 0 && stack[n-1].contains(b) {
+			continue // duplicated or merged
+		}
+		stack = append(stack, b)
+		// merge the siblings such as 10.0.0.0/25 and 10.0.0.128/25 into 10.0.0.0/24.
+		for n := len(stack); n > 1; n = len(stack) {
+			x, y := stack[n-2], stack[n-1]
+			if x.bits != y.bits || x.bits == 0 || x.base+x.size() != y.base || x.base&(x.size()<<1-1) != 0 {
+				break
+			}
+			stack = append(stack[:n-2], block{x.base, x.bits - 1})
+		}
+	}
+
+	v4 := make([]*net.IPNet, 0, len(stack))
+	for _, b := range stack {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, b.base)
+		v4 = append(v4, &net.IPNet{IP: ip, Mask: net.CIDRMask(b.bits, 32)})
+	}
+	return append(v4, nets...)
+}
+
+// WriteIPTables writes the rules as iptables and ip6tables commands. The connections established
+// are accepted by the commands of each address family that the rules have.
+func WriteIPTables(w io.Writer, rules []*Rule) error {
+	var lines []string
+	families := map[string]bool{}
+	for _, r := range rules {
+		for _, n := range r.Nets {
+			cmd := "iptables"
+			if n.IP.To4() == nil {
+				cmd = "ip6tables"
+			}
+			families[cmd] = true
+			if r.Direction == conntrack.FlowPassive {
+				lines = append(lines, fmt.Sprintf("%s -A INPUT -p tcp -s %s --dport %s -m conntrack --ctstate NEW -j ACCEPT", cmd, n, r.Port))
+			} else {
+				lines = append(lines, fmt.Sprintf("%s -A OUTPUT -p tcp -d %s --dport %s -m conntrack --ctstate NEW -j ACCEPT", cmd, n, r.Port))
+			}
+		}
+	}
+	var established []string
+	for _, cmd := range []string{"iptables", "ip6tables"} {
+		if families[cmd] {
+			established = append(established,
+				cmd+" -A INPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+				cmd+" -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+			)
+		}
+	}
+	lines = append(established, lines...)
+	if len(lines) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// WriteNftables writes the rules as a nftables table, whose chains accept all
+// by default. The policy should be turned into drop after the review.
+func WriteNftables(w io.Writer, rules []*Rule) error {
+	var b strings.Builder
+	b.WriteString("table inet lsconntrack {\n")
+	for _, chain := range []struct {
+		name      string
+		direction conntrack.FlowDirection
+		addr      string
+	}{
+		{"input", conntrack.FlowPassive, "saddr"},
+		{"output", conntrack.FlowActive, "daddr"},
+	} {
+		fmt.Fprintf(&b, "\tchain %s {\n", chain.name)
+		fmt.Fprintf(&b, "\t\ttype filter hook %s priority 0; policy accept;\n", chain.name)
+		b.WriteString("\t\tct state established,related accept\n")
+		for _, r := range rules {
+			if r.Direction != chain.direction {
+				continue
+			}
+			var v4, v6 []string
+			for _, n := range r.Nets {
+				if n.IP.To4() != nil {
+					v4 = append(v4, n.String())
+				} else {
+					v6 = append(v6, n.String())
+				}
+			}
+			if len(v4) > 0 {
+				fmt.Fprintf(&b, "\t\tip %s { %s } tcp dport %s accept\n", chain.addr, strings.Join(v4, ", "), r.Port)
+			}
+			if len(v6) > 0 {
+				fmt.Fprintf(&b, "\t\tip6 %s { %s } tcp dport %s accept\n", chain.addr, strings.Join(v6, ", "), r.Port)
+			}
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteUFW writes the rules as ufw commands.
+func WriteUFW(w io.Writer, rules []*Rule) error {
+	var lines []string
+	for _, r := range rules {
+		for _, n := range r.Nets {
+			if r.Direction == conntrack.FlowPassive {
+				lines = append(lines, fmt.Sprintf("ufw allow in proto tcp from %s to any port %s", n, r.Port))
+			} else {
+				lines = append(lines, fmt.Sprintf("ufw allow out proto tcp from any to %s port %s", n, r.Port))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
@@ -0,0 +1,185 @@
+package firewall
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+func TestRollUp(t *testing.T) {
+	tests := []struct {
+		desc     string
+		addrs    []string
+		prefix   int
+		expected []string
+	}{
+		{
+			desc:     "hosts",
+			addrs:    []string{"10.0.1.11", "10.0.1.10", "10.0.1.11"},
+			prefix:   32,
+			expected: []string{"10.0.1.10/31"},
+		},
+		{
+			desc:     "not siblings",
+			addrs:    []string{"10.0.1.11", "10.0.1.12"},
+			prefix:   32,
+			expected: []string{"10.0.1.11/32", "10.0.1.12/32"},
+		},
+		{
+			desc:     "sibling networks",
+			addrs:    []string{"10.0.0.1", "10.0.1.1", "10.0.2.1", "10.0.3.1", "10.0.3.2", "192.168.0.1"},
+			prefix:   24,
+			expected: []string{"10.0.0.0/22", "192.168.0.0/24"},
+		},
+		{
+			desc:     "ipv6",
+			addrs:    []string{"10.0.0.1", "fd00::1"},
+			prefix:   32,
+			expected: []string{"10.0.0.1/32", "fd00::1/128"},
+		},
+	}
+	for _, tc := range tests {
+		var ips []net.IP
+		for _, addr := range tc.addrs {
+			ips = append(ips, net.ParseIP(addr))
+		}
+		var got []string
+		for _, n := range rollUp(ips, tc.prefix) {
+			got = append(got, n.String())
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("desc: %q, rollUp should be %v, not %v", tc.desc, tc.expected, got)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	flows := conntrack.HostFlows{
+		"active": {
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "3306"},
+		},
+		"passive": {
+			Direction: conntrack.FlowPassive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "80"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.2.10", Port: "many"},
+		},
+	}
+	rules := Rules(flows, 24)
+
+	tests := []struct {
+		desc     string
+		write    func(*bytes.Buffer) error
+		expected []string
+	}{
+		{
+			desc:  "iptables",
+			write: func(b *bytes.Buffer) error { return WriteIPTables(b, rules) },
+			expected: []string{
+				"iptables -A INPUT -p tcp -s 10.0.2.0/24 --dport 80 -m conntrack --ctstate NEW -j ACCEPT\n",
+				"iptables -A OUTPUT -p tcp -d 10.0.1.0/24 --dport 3306 -m conntrack --ctstate NEW -j ACCEPT\n",
+			},
+		},
+		{
+			desc:  "nftables",
+			write: func(b *bytes.Buffer) error { return WriteNftables(b, rules) },
+			expected: []string{
+				"ip saddr { 10.0.2.0/24 } tcp dport 80 accept\n",
+				"ip daddr { 10.0.1.0/24 } tcp dport 3306 accept\n",
+			},
+		},
+		{
+			desc:  "ufw",
+			write: func(b *bytes.Buffer) error { return WriteUFW(b, rules) },
+			expected: []string{
+				"ufw allow in proto tcp from 10.0.2.0/24 to any port 80\n",
+				"ufw allow out proto tcp from any to 10.0.1.0/24 port 3306\n",
+			},
+		},
+	}
+	for _, tc := range tests {
+		var b bytes.Buffer
+		if err := tc.write(&b); err != nil {
+			t.Fatalf("desc: %q, should not return error: %v", tc.desc, err)
+		}
+		for _, line := range tc.expected {
+			if !strings.Contains(b.String(), line) {
+				t.Errorf("desc: %q, output should contain %q, got %q", tc.desc, line, b.String())
+			}
+		}
+	}
+}
+
+func TestWriteIPTables_established(t *testing.T) {
+	flow := func(peer string) *conntrack.HostFlow {
+		return &conntrack.HostFlow{
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: peer, Port: "3306"},
+		}
+	}
+	tests := []struct {
+		desc     string
+		peers    []string
+		expected []string
+	}{
+		{
+			desc:  "ipv4",
+			peers: []string{"10.0.1.10"},
+			expected: []string{
+				"iptables -A INPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+				"iptables -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+				"iptables -A OUTPUT -p tcp -d 10.0.1.10/32 --dport 3306 -m conntrack --ctstate NEW -j ACCEPT",
+			},
+		},
+		{
+			desc:  "ipv6",
+			peers: []string{"fd00::10"},
+			expected: []string{
+				"ip6tables -A INPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+				"ip6tables -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+				"ip6tables -A OUTPUT -p tcp -d fd00::10/128 --dport 3306 -m conntrack --ctstate NEW -j ACCEPT",
+			},
+		},
+		{
+			desc:  "dual stack",
+			peers: []string{"10.0.1.10", "fd00::10"},
+			expected: []string{
+				"iptables -A INPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+				"iptables -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+				"ip6tables -A INPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+				"ip6tables -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+				"iptables -A OUTPUT -p tcp -d 10.0.1.10/32 --dport 3306 -m conntrack --ctstate NEW -j ACCEPT",
+				"ip6tables -A OUTPUT -p tcp -d fd00::10/128 --dport 3306 -m conntrack --ctstate NEW -j ACCEPT",
+			},
+		},
+		{
+			desc:     "no rules",
+			peers:    nil,
+			expected: nil,
+		},
+	}
+	for _, tc := range tests {
+		flows := conntrack.HostFlows{}
+		for _, peer := range tc.peers {
+			f := flow(peer)
+			flows[f.UniqKey()] = f
+		}
+		var b bytes.Buffer
+		if err := WriteIPTables(&b, Rules(flows, 32)); err != nil {
+			t.Fatalf("desc: %q, should not return error: %v", tc.desc, err)
+		}
+		var got []string
+		if b.Len() > 0 {
+			got = strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("desc: %q, the commands should be %q, not %q", tc.desc, tc.expected, got)
+		}
+	}
+}
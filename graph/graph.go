@@ -0,0 +1,199 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+// Weight are the metric to weight the edges.
+type Weight int
+
+const (
+	// WeightBytes are the sum of the inbound and outbound bytes.
+	WeightBytes Weight = iota
+	// WeightConns are the number of connections.
+	WeightConns
+)
+
+// ParseWeight parses "bytes" or "conns".
+func ParseWeight(s string) (Weight, error) {
+	switch s {
+	case "bytes":
+		return WeightBytes, nil
+	case "conns":
+		return WeightConns, nil
+	}
+	return 0, fmt.Errorf("unknown weight: %s", s)
+}
+
+func (w Weight) of(s *conntrack.HostFlowStat) int64 {
+	if w == WeightConns {
+		return s.TotalConnections
+	}
+	return s.TotalInboundBytes + s.TotalOutboundBytes
+}
+
+func (w Weight) label(v int64) string {
+	if w == WeightConns {
+		return fmt.Sprintf("%d conns", v)
+	}
+	return fmt.Sprintf("%d bytes", v)
+}
+
+// Edge represents the host flows from the client to the server.
+type Edge struct {
+	From, To  string
+	Direction conntrack.FlowDirection
+	// Ports are the local ports of the passive flows, since the local node has no port.
+	Ports []string
+	Value int64
+}
+
+// label returns the label of the edge weighted by weight.
+func (e *Edge) label(weight Weight) string {
+	if len(e.Ports) == 0 {
+		return weight.label(e.Value)
+	}
+	return ":" + strings.Join(e.Ports, ",:") + " " + weight.label(e.Value)
+}
+
+// localNode returns the node of the local endpoint, which are one per host,
+// or per owner such as a container if the flows are labeled with the owners.
+func localNode(flow *conntrack.HostFlow) string {
+	if flow.Local.Addr == "localhost" && flow.Host != "" {
+		return flow.Host
+	}
+	return flow.Local.Addr
+}
+
+// Edges returns the edges of the flows, sorted by the nodes.
+// The active flows are from the local host to the peer port,
+// the passive flows are from the peer host to the local host,
+// and the forwarded flows are from the client to the server port.
+// The flows between the same nodes, such as the ones in different network namespaces
+// or through different NAT, are merged into an edge.
+func Edges(flows conntrack.HostFlows, weight Weight) []*Edge {
+	edges := make([]*Edge, 0, len(flows))
+	index := map[[2]string]*Edge{}
+	for _, flow := range flows.List() {
+		var from, to string
+		switch flow.Direction {
+		case conntrack.FlowActive:
+			from, to = localNode(flow), flow.Peer.String()
+		case conntrack.FlowPassive:
+			from, to = flow.Peer.Addr, localNode(flow)
+		case conntrack.FlowForwarded:
+			from, to = flow.Local.Addr, flow.Peer.String()
+		default:
+			continue
+		}
+		e, ok := index[[2]string{from, to}]
+		if !ok {
+			e = &Edge{From: from, To: to, Direction: flow.Direction}
+			index[[2]string{from, to}] = e
+			edges = append(edges, e)
+		}
+		e.Value += weight.of(flow.Stat)
+		if flow.Direction == conntrack.FlowPassive && !contains(e.Ports, flow.Local.Port) {
+			e.Ports = append(e.Ports, flow.Local.Port)
+			sort.Strings(e.Ports)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// nodes returns the nodes of the edges in order of appearance.
+func nodes(edges []*Edge) []string {
+	var list []string
+	seen := map[string]bool{}
+	for _, e := range edges {
+		for _, n := range []string{e.From, e.To} {
+			if !seen[n] {
+				seen[n] = true
+				list = append(list, n)
+			}
+		}
+	}
+	return list
+}
+
+// penwidth returns the width of the edge between 1 and 5 in proportion to the value.
+func penwidth(v, max int64) float64 {
+	if max == 0 {
+		return 1
+	}
+	return 1 + 4*float64(v)/float64(max)
+}
+
+var dotStyles = map[conntrack.FlowDirection]string{
+	conntrack.FlowActive:    `style=solid, color="#1f77b4"`,
+	conntrack.FlowPassive:   `style=dashed, color="#2ca02c"`,
+	conntrack.FlowForwarded: `style=dotted, color="#7f7f7f"`,
+}
+
+// WriteDOT writes the flows as a Graphviz DOT digraph.
+func WriteDOT(w io.Writer, flows conntrack.HostFlows, weight Weight) error {
+	edges := Edges(flows, weight)
+	var max int64
+	for _, e := range edges {
+		if e.Value > max {
+			max = e.Value
+		}
+	}
+	var b strings.Builder
+	b.WriteString("digraph lsconntrack {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, n := range nodes(edges) {
+		fmt.Fprintf(&b, "\t%q;\n", n)
+	}
+	for _, e := range edges {
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q, penwidth=%.1f, %s];\n",
+			e.From, e.To, e.label(weight), penwidth(e.Value, max), dotStyles[e.Direction])
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var mermaidArrows = map[conntrack.FlowDirection]string{
+	conntrack.FlowActive:    "-->",
+	conntrack.FlowPassive:   "-.->",
+	conntrack.FlowForwarded: "==>",
+}
+
+// WriteMermaid writes the flows as a Mermaid flowchart.
+func WriteMermaid(w io.Writer, flows conntrack.HostFlows, weight Weight) error {
+	edges := Edges(flows, weight)
+	ids := map[string]string{}
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	for i, n := range nodes(edges) {
+		ids[n] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "    %s[\"%s\"]\n", ids[n], strings.Replace(n, `"`, "#quot;", -1))
+	}
+	for _, e := range edges {
+		fmt.Fprintf(&b, "    %s %s|%s| %s\n", ids[e.From], mermaidArrows[e.Direction], e.label(weight), ids[e.To])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
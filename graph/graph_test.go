@@ -0,0 +1,111 @@
+package graph
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+var testFlows = conntrack.HostFlows{
+	"active": {
+		Direction: conntrack.FlowActive,
+		Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+		Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "3306"},
+		Stat:      &conntrack.HostFlowStat{TotalInboundBytes: 300, TotalOutboundBytes: 100, TotalConnections: 4},
+	},
+	"passive": {
+		Direction: conntrack.FlowPassive,
+		Local:     &conntrack.AddrPort{Addr: "localhost", Port: "80"},
+		Peer:      &conntrack.AddrPort{Addr: "10.0.2.10", Port: "many"},
+		Stat:      &conntrack.HostFlowStat{TotalInboundBytes: 100, TotalConnections: 1},
+	},
+}
+
+func TestEdges(t *testing.T) {
+	flows := conntrack.HostFlows{
+		"active": {
+			Host:      "web01",
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "3306"},
+			Stat:      &conntrack.HostFlowStat{TotalConnections: 4},
+		},
+		"active in netns": {
+			Host:      "web01",
+			Direction: conntrack.FlowActive,
+			Netns:     "blue",
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "3306"},
+			Stat:      &conntrack.HostFlowStat{TotalConnections: 2},
+		},
+		"passive on 80": {
+			Host:      "web01",
+			Direction: conntrack.FlowPassive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "80"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.2.10", Port: "many"},
+			Stat:      &conntrack.HostFlowStat{TotalConnections: 1},
+		},
+		"passive on 443": {
+			Host:      "web01",
+			Direction: conntrack.FlowPassive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "443"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.2.10", Port: "many"},
+			Stat:      &conntrack.HostFlowStat{TotalConnections: 3},
+		},
+	}
+	edges := Edges(flows, WeightConns)
+	expected := []Edge{
+		{From: "10.0.2.10", To: "web01", Direction: conntrack.FlowPassive, Ports: []string{"443", "80"}, Value: 4},
+		{From: "web01", To: "10.0.1.10:3306", Direction: conntrack.FlowActive, Value: 6},
+	}
+	if len(edges) != len(expected) {
+		t.Fatalf("edges should be %d, not %d", len(expected), len(edges))
+	}
+	for i, e := range edges {
+		if !reflect.DeepEqual(*e, expected[i]) {
+			t.Errorf("edge should be %v, not %v", expected[i], *e)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		desc     string
+		write    func(*bytes.Buffer) error
+		expected []string
+	}{
+		{
+			desc:  "dot",
+			write: func(b *bytes.Buffer) error { return WriteDOT(b, testFlows, WeightBytes) },
+			expected: []string{
+				"digraph lsconntrack {\n",
+				`"localhost" -> "10.0.1.10:3306" [label="400 bytes", penwidth=5.0, style=solid`,
+				`"10.0.2.10" -> "localhost" [label=":80 100 bytes", penwidth=2.0, style=dashed`,
+			},
+		},
+		{
+			desc:  "mermaid",
+			write: func(b *bytes.Buffer) error { return WriteMermaid(b, testFlows, WeightConns) },
+			expected: []string{
+				"graph LR\n",
+				"    n0[\"10.0.2.10\"]\n",
+				"    n0 -.->|:80 1 conns| n1\n",
+				"    n1 -->|4 conns| n2\n",
+			},
+		},
+	}
+	for _, tc := range tests {
+		var b bytes.Buffer
+		if err := tc.write(&b); err != nil {
+			t.Fatalf("desc: %q, should not return error: %v", tc.desc, err)
+		}
+		for _, s := range tc.expected {
+			if !strings.Contains(b.String(), s) {
+				t.Errorf("desc: %q, output should contain %q, got %q", tc.desc, s, b.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/humanize"
+)
+
+// statFormatter formats the stat columns of the table.
+type statFormatter struct {
+	// human prints the bytes in KiB, MiB and GiB and the packets in k and M.
+	human bool
+	// rates prints the inbound and outbound bytes per second since the previous round.
+	rates bool
+	// prev are the stats of the previous round by the unique key.
+	prev   map[string]*conntrack.HostFlowStat
+	prevAt time.Time
+	at     time.Time
+}
+
+// header returns the header of the stat columns.
+func (s *statFormatter) header() string {
+	header := "Inpkts \tInbytes \tOutpkts \tOutbytes"
+	if s != nil && s.rates {
+		header += " \tIn/s \tOut/s"
+	}
+	return header
+}
+
+// format returns the stat columns of the flow stored by the key.
+func (s *statFormatter) format(key string, flow *conntrack.HostFlow) string {
+	if s == nil || !s.human {
+		return flow.Stat.String()
+	}
+	st := flow.Stat
+	line := fmt.Sprintf("%s \t%s \t%s \t%s",
+		humanize.Count(st.TotalInboundPackets), humanize.Bytes(st.TotalInboundBytes),
+		humanize.Count(st.TotalOutboundPackets), humanize.Bytes(st.TotalOutboundBytes))
+	if !s.rates {
+		return line
+	}
+	prev, ok := s.prev[key]
+	elapsed := s.at.Sub(s.prevAt).Seconds()
+	if !ok || elapsed <= 0 {
+		// no rates on the first round or the new flows.
+		return line + " \t- \t-"
+	}
+	d := st.Sub(prev)
+	return fmt.Sprintf("%s \t%s \t%s", line,
+		humanize.ByteRate(rate(d.TotalInboundBytes, elapsed)),
+		humanize.ByteRate(rate(d.TotalOutboundBytes, elapsed)))
+}
+
+// formatSeen returns the columns of when the flow is seen and the total bytes while seen.
+func formatSeen(seen *conntrack.Seen, human bool) string {
+	if seen == nil {
+		return "- \t- \t- \t-"
+	}
+	in, out := fmt.Sprint(seen.Totals.TotalInboundBytes), fmt.Sprint(seen.Totals.TotalOutboundBytes)
+	if human {
+		in, out = humanize.Bytes(seen.Totals.TotalInboundBytes), humanize.Bytes(seen.Totals.TotalOutboundBytes)
+	}
+	return fmt.Sprintf("%s \t%s \t%s \t%s", seen.FirstSeen.Format(time.RFC3339), seen.LastSeen.Format(time.RFC3339), in, out)
+}
+
+// rate returns the delta per second.
+func rate(delta int64, seconds float64) float64 {
+	return float64(delta) / seconds
+}
+
+// observe sets the round of the flows to be printed.
+// The rates are printed in human mode only in watch mode.
+func (s *statFormatter) observe(t *tick) {
+	s.rates = s.human && t != nil
+	if t != nil {
+		s.prevAt, s.at = s.at, t.at
+	}
+}
+
+// remember keeps the stats of the flows printed in the round.
+func (s *statFormatter) remember(flows conntrack.HostFlows) {
+	s.prev = make(map[string]*conntrack.HostFlowStat, len(flows))
+	for key, flow := range flows {
+		s.prev[key] = flow.Stat
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+func TestStatFormatter(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	flow := func(inBytes, outBytes int64) *conntrack.HostFlow {
+		return &conntrack.HostFlow{
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "3306"},
+			Stat: &conntrack.HostFlowStat{
+				TotalInboundPackets:  1500,
+				TotalInboundBytes:    inBytes,
+				TotalOutboundPackets: 12,
+				TotalOutboundBytes:   outBytes,
+			},
+		}
+	}
+	tests := []struct {
+		desc     string
+		stats    *statFormatter
+		ticks    []*tick
+		rounds   []int64
+		expected string
+	}{
+		{
+			desc:     "not human",
+			stats:    nil,
+			expected: "1500 \t1048576 \t12 \t2048",
+		},
+		{
+			desc:     "human",
+			stats:    &statFormatter{human: true},
+			ticks:    []*tick{nil},
+			rounds:   []int64{1048576},
+			expected: "1.5k \t1.0 MiB \t12 \t2.0 KiB",
+		},
+		{
+			desc:     "first round in watch mode",
+			stats:    &statFormatter{human: true},
+			ticks:    []*tick{{seq: 1, at: at}},
+			rounds:   []int64{1048576},
+			expected: "1.5k \t1.0 MiB \t12 \t2.0 KiB \t- \t-",
+		},
+		{
+			desc:     "second round in watch mode",
+			stats:    &statFormatter{human: true},
+			ticks:    []*tick{{seq: 1, at: at}, {seq: 2, at: at.Add(2 * time.Second)}},
+			rounds:   []int64{0, 1048576},
+			expected: "1.5k \t1.0 MiB \t12 \t2.0 KiB \t512.0 KiB/s \t0 B/s",
+		},
+	}
+	for _, tc := range tests {
+		var f *conntrack.HostFlow
+		for i, tk := range tc.ticks {
+			f = flow(tc.rounds[i], 2048)
+			tc.stats.observe(tk)
+			if i < len(tc.ticks)-1 {
+				tc.stats.remember(conntrack.HostFlows{"key": f})
+			}
+		}
+		if f == nil {
+			f = flow(1048576, 2048)
+		}
+		if got := tc.stats.format("key", f); got != tc.expected {
+			t.Errorf("desc: %q, format() should be %q, not %q", tc.desc, tc.expected, got)
+		}
+	}
+}
+
+func TestFormatSeen(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	seen := &conntrack.Seen{
+		FirstSeen: at,
+		LastSeen:  at.Add(time.Hour),
+		Totals:    &conntrack.HostFlowStat{TotalInboundBytes: 2048, TotalOutboundBytes: 100},
+	}
+	tests := []struct {
+		desc     string
+		seen     *conntrack.Seen
+		human    bool
+		expected string
+	}{
+		{"not tracked", nil, false, "- \t- \t- \t-"},
+		{"tracked", seen, false, "2026-01-02T03:04:05Z \t2026-01-02T04:04:05Z \t2048 \t100"},
+		{"human", seen, true, "2026-01-02T03:04:05Z \t2026-01-02T04:04:05Z \t2.0 KiB \t100 B"},
+	}
+	for _, tc := range tests {
+		if got := formatSeen(tc.seen, tc.human); got != tc.expected {
+			t.Errorf("desc: %q, formatSeen should be %q, not %q", tc.desc, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package humanize
+
+import "fmt"
+
+var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// Bytes returns the bytes in the binary units such as "1.4 MiB".
+func Bytes(n int64) string {
+	if n < 1024 && n > -1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	v := float64(n)
+	i := 0
+	for (v >= 1024 || v <= -1024) && i < len(byteUnits)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", v, byteUnits[i])
+}
+
+var countUnits = []string{"", "k", "M", "G", "T", "P", "E"}
+
+// Count returns the count in the SI units such as "1.5k".
+func Count(n int64) string {
+	if n < 1000 && n > -1000 {
+		return fmt.Sprintf("%d", n)
+	}
+	v := float64(n)
+	i := 0
+	for (v >= 1000 || v <= -1000) && i < len(countUnits)-1 {
+		v /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", v, countUnits[i])
+}
+
+// ByteRate returns the bytes per second in the binary units such as "1.4 MiB/s".
+func ByteRate(v float64) string {
+	return Bytes(int64(v)) + "/s"
+}
@@ -0,0 +1,39 @@
+package humanize
+
+import "testing"
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		n        int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1480239, "1.4 MiB"},
+		{282041045, "269.0 MiB"},
+		{5 << 30, "5.0 GiB"},
+	}
+	for _, tc := range tests {
+		if got := Bytes(tc.n); got != tc.expected {
+			t.Errorf("Bytes(%d) should be %q, not %q", tc.n, tc.expected, got)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		n        int64
+		expected string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1491, "1.5k"},
+		{2500000, "2.5M"},
+	}
+	for _, tc := range tests {
+		if got := Count(tc.n); got != tc.expected {
+			t.Errorf("Count(%d) should be %q, not %q", tc.n, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package ipfix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+// Version are the protocol version of the export packets.
+type Version uint16
+
+const (
+	// NetFlowV9 are Cisco Systems NetFlow Services Export Version 9 (RFC 3954).
+	NetFlowV9 Version = 9
+	// IPFIX are IP Flow Information Export (RFC 7011).
+	IPFIX Version = 10
+)
+
+// ParseVersion parses "ipfix" or "netflow9".
+func ParseVersion(s string) (Version, error) {
+	switch s {
+	case "ipfix":
+		return IPFIX, nil
+	case "netflow9":
+		return NetFlowV9, nil
+	}
+	return 0, fmt.Errorf("unknown export protocol: %s", s)
+}
+
+// protocolTCP are the protocol number of TCP.
+const protocolTCP = 6
+
+// Record are the unidirectional flow in an interval.
+type Record struct {
+	Src, Dst         net.IP
+	SrcPort, DstPort uint16
+	Octets, Packets  uint64
+	Start, End       time.Time
+}
+
+// Records returns the records of the host flows whose stats are the deltas between start and end.
+// Each flow makes the record from the client to the server and the record back unless their counters are 0.
+// The local endpoints of the active and passive flows are the first address in locals of the same family as the peer.
+// The flows whose peer is not an IP address, such as the resolved names, are skipped.
+func Records(flows conntrack.HostFlows, locals []string, start, end time.Time) []*Record {
+	var records []*Record
+	for _, flow := range flows.List() {
+		var client, server net.IP
+		var port string
+		var toServer, toClient [2]int64 // packets and bytes
+		st := flow.Stat
+		switch flow.Direction {
+		case conntrack.FlowActive:
+			server = net.ParseIP(flow.Peer.Addr)
+			client, port = localAddr(locals, server), flow.Peer.Port
+			toServer = [2]int64{st.TotalOutboundPackets, st.TotalOutboundBytes}
+			toClient = [2]int64{st.TotalInboundPackets, st.TotalInboundBytes}
+		case conntrack.FlowPassive:
+			client = net.ParseIP(flow.Peer.Addr)
+			server, port = localAddr(locals, client), flow.Local.Port
+			toServer = [2]int64{st.TotalInboundPackets, st.TotalInboundBytes}
+			toClient = [2]int64{st.TotalOutboundPackets, st.TotalOutboundBytes}
+		case conntrack.FlowForwarded:
+			client, server, port = net.ParseIP(flow.Local.Addr), net.ParseIP(flow.Peer.Addr), flow.Peer.Port
+			toServer = [2]int64{st.TotalOutboundPackets, st.TotalOutboundBytes}
+			toClient = [2]int64{st.TotalInboundPackets, st.TotalInboundBytes}
+		}
+		if client == nil || server == nil {
+			continue
+		}
+		p, _ := strconv.ParseUint(port, 10, 16)
+		if toServer[0] > 0 || toServer[1] > 0 {
+			records = append(records, &Record{
+				Src: client, Dst: server, DstPort: uint16(p),
+				Packets: uint64(toServer[0]), Octets: uint64(toServer[1]),
+				Start: start, End: end,
+			})
+		}
+		if toClient[0] > 0 || toClient[1] > 0 {
+			records = append(records, &Record{
+				Src: server, Dst: client, SrcPort: uint16(p),
+				Packets: uint64(toClient[0]), Octets: uint64(toClient[1]),
+				Start: start, End: end,
+			})
+		}
+	}
+	return records
+}
+
+// localAddr returns the first address in locals of the same family as peer, or the unspecified address.
+func localAddr(locals []string, peer net.IP) net.IP {
+	if peer == nil {
+		return nil
+	}
+	v4 := peer.To4() != nil
+	for _, addr := range locals {
+		ip := net.ParseIP(addr)
+		if ip != nil && (ip.To4() != nil) == v4 {
+			return ip
+		}
+	}
+	if v4 {
+		return net.IPv4zero
+	}
+	return net.IPv6unspecified
+}
+
+// field are the information element in the templates.
+type field struct {
+	id, length uint16
+}
+
+// template are the template of the data records of an address family.
+type template struct {
+	id     uint16
+	v4     bool
+	fields []field
+}
+
+// templates returns the templates of IPv4 and IPv6 records.
+// The start and end time are flowStartSeconds and flowEndSeconds on IPFIX,
+// and FIRST_SWITCHED and LAST_SWITCHED in the system uptime on NetFlow v9.
+func templates(v Version) []*template {
+	start, end := field{150, 4}, field{151, 4}
+	if v == NetFlowV9 {
+		start, end = field{22, 4}, field{21, 4}
+	}
+	rest := []field{
+		{7, 2},  // sourceTransportPort
+		{11, 2}, // destinationTransportPort
+		{4, 1},  // protocolIdentifier
+		{1, 8},  // octetDeltaCount
+		{2, 8},  // packetDeltaCount
+		start,
+		end,
+	}
+	return []*template{
+		// sourceIPv4Address and destinationIPv4Address
+		{id: 256, v4: true, fields: append([]field{{8, 4}, {12, 4}}, rest...)},
+		// sourceIPv6Address and destinationIPv6Address
+		{id: 257, v4: false, fields: append([]field{{27, 16}, {28, 16}}, rest...)},
+	}
+}
+
+// maxRecords are the number of the records in a message not to exceed the MTU of the ethernet.
+const maxRecords = 20
+
+// Exporter sends the deltas of the host flows between the rounds to the collector over UDP.
+type Exporter struct {
+	conn    net.Conn
+	version Version
+	// domain are the observation domain ID on IPFIX or the source ID on NetFlow v9.
+	domain uint32
+	// sequence are the number of the data records sent on IPFIX or the packets sent on NetFlow v9.
+	sequence uint32
+	// boot are when the exporter started, from which the system uptime of NetFlow v9 are counted.
+	boot   time.Time
+	deltas conntrack.DeltaTracker
+}
+
+// Dial returns the exporter to the collector at addr such as 'localhost:4739'.
+func Dial(addr string, version Version, domain uint32) (*Exporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Exporter{conn: conn, version: version, domain: domain, boot: time.Now()}, nil
+}
+
+// Close closes the connection.
+func (e *Exporter) Close() error {
+	return e.conn.Close()
+}
+
+// Export sends the records of the host flows since the previous round at the time.
+// The first round sends nothing.
+func (e *Exporter) Export(flows conntrack.HostFlows, locals []string, at time.Time) error {
+	deltas, start := e.deltas.Deltas(flows, at)
+	if start.IsZero() {
+		return nil
+	}
+	records := Records(deltas, locals, start, at)
+	for i := 0; i < len(records); i += maxRecords {
+		end := i + maxRecords
+		if end > len(records) {
+			end = len(records)
+		}
+		if _, err := e.conn.Write(e.encode(records[i:end], at)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode returns the message of the templates and the records exported at the time.
+func (e *Exporter) encode(records []*Record, at time.Time) []byte {
+	var body bytes.Buffer
+	tmpls := templates(e.version)
+
+	// the templates are sent in every message since UDP may lose them.
+	templateSetID := uint16(2)
+	if e.version == NetFlowV9 {
+		templateSetID = 0
+	}
+	var set bytes.Buffer
+	for _, t := range tmpls {
+		put(&set, t.id, uint16(len(t.fields)))
+		for _, f := range t.fields {
+			put(&set, f.id, f.length)
+		}
+	}
+	writeSet(&body, templateSetID, set.Bytes())
+
+	for _, t := range tmpls {
+		set.Reset()
+		for _, r := range records {
+			if (r.Src.To4() != nil) != t.v4 {
+				continue
+			}
+			if t.v4 {
+				set.Write(r.Src.To4())
+				set.Write(r.Dst.To4())
+			} else {
+				set.Write(r.Src.To16())
+				set.Write(r.Dst.To16())
+			}
+			put(&set, r.SrcPort, r.DstPort, uint8(protocolTCP), r.Octets, r.Packets)
+			if e.version == NetFlowV9 {
+				put(&set, e.uptime(r.Start), e.uptime(r.End))
+			} else {
+				put(&set, uint32(r.Start.Unix()), uint32(r.End.Unix()))
+			}
+		}
+		if set.Len() > 0 {
+			writeSet(&body, t.id, set.Bytes())
+		}
+	}
+
+	var msg bytes.Buffer
+	if e.version == NetFlowV9 {
+		e.sequence++
+		count := uint16(len(tmpls) + len(records))
+		put(&msg, uint16(NetFlowV9), count, e.uptime(at), uint32(at.Unix()), e.sequence, e.domain)
+	} else {
+		length := uint16(16 + body.Len())
+		put(&msg, uint16(IPFIX), length, uint32(at.Unix()), e.sequence, e.domain)
+		e.sequence += uint32(len(records))
+	}
+	msg.Write(body.Bytes())
+	return msg.Bytes()
+}
+
+// uptime returns the milliseconds from the boot of the exporter to t.
+func (e *Exporter) uptime(t time.Time) uint32 {
+	if t.Before(e.boot) {
+		return 0
+	}
+	return uint32(t.Sub(e.boot) / time.Millisecond)
+}
+
+// writeSet writes the set with the header, padded to the 4 octets boundary.
+func writeSet(w *bytes.Buffer, id uint16, body []byte) {
+	padding := (4 - len(body)%4) % 4
+	put(w, id, uint16(4+len(body)+padding))
+	w.Write(body)
+	w.Write(make([]byte, padding))
+}
+
+// put writes the values in network byte order.
+func put(w *bytes.Buffer, values ...interface{}) {
+	for _, v := range values {
+		binary.Write(w, binary.BigEndian, v)
+	}
+}
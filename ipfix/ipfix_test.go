@@ -0,0 +1,140 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack/conntracktest"
+)
+
+func TestRecords(t *testing.T) {
+	entries := `tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=2 bytes=200 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=10 bytes=1000 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 86399 ESTABLISHED src=2001:db8::1 dst=2001:db8::10 sport=52110 dport=80 packets=10 bytes=1000 src=2001:db8::10 dst=2001:db8::1 sport=80 dport=52110 packets=0 bytes=0 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.20 sport=41144 dport=5432 packets=1 bytes=100 src=10.0.1.20 dst=10.0.0.10 sport=5432 dport=41144 packets=1 bytes=1000 [ASSURED] mark=0 secmark=0 use=1
+`
+	locals := []string{"10.0.0.10", "2001:db8::10"}
+	web := conntracktest.Host{Locals: locals, Passive: []string{"80"}}
+	flows := web.Parse(t, entries)
+	// the peers resolved into the names are not exported.
+	flows = flows.Resolved(func(addr string) string {
+		if addr == "10.0.1.20" {
+			return "db.example.com"
+		}
+		return addr
+	})
+	start, end := time.Unix(1500000000, 0), time.Unix(1500000010, 0)
+	got := Records(flows, locals, start, end)
+	expected := []*Record{
+		{Src: net.ParseIP("10.0.0.10"), Dst: net.ParseIP("10.0.1.10"), DstPort: 3306, Packets: 2, Octets: 200, Start: start, End: end},
+		{Src: net.ParseIP("10.0.1.10"), Dst: net.ParseIP("10.0.0.10"), SrcPort: 3306, Packets: 10, Octets: 1000, Start: start, End: end},
+		{Src: net.ParseIP("2001:db8::1"), Dst: net.ParseIP("2001:db8::10"), DstPort: 80, Packets: 10, Octets: 1000, Start: start, End: end},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Records should be %v, not %v", expected, got)
+	}
+}
+
+// collected are the data records decoded by the collector stub.
+type collected struct {
+	version uint16
+	records [][]byte
+}
+
+// decode decodes the message with the templates in it.
+func decode(t *testing.T, msg []byte) *collected {
+	c := &collected{version: binary.BigEndian.Uint16(msg)}
+	headerLen, templateSetID := 16, uint16(2)
+	if c.version == uint16(NetFlowV9) {
+		headerLen, templateSetID = 20, 0
+	} else if l := int(binary.BigEndian.Uint16(msg[2:])); l != len(msg) {
+		t.Fatalf("message length should be %d, not %d", len(msg), l)
+	}
+	lengths := map[uint16]int{}
+	for b := msg[headerLen:]; len(b) > 0; {
+		id, l := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if l%4 != 0 || l > len(b) {
+			t.Fatalf("set %d has the invalid length %d", id, l)
+		}
+		set := b[4:l]
+		if id == templateSetID {
+			for len(set) > 0 {
+				tid, n := binary.BigEndian.Uint16(set), int(binary.BigEndian.Uint16(set[2:]))
+				for i := 0; i < n; i++ {
+					lengths[tid] += int(binary.BigEndian.Uint16(set[4+4*i+2:]))
+				}
+				set = set[4+4*n:]
+			}
+		} else {
+			for rl := lengths[id]; len(set) >= rl; set = set[rl:] {
+				c.records = append(c.records, set[:rl])
+			}
+		}
+		b = b[l:]
+	}
+	return c
+}
+
+func TestExporter_Export(t *testing.T) {
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the inbound bytes of both flows increase by 500 in the second round.
+	rounds := []string{
+		`tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=2 bytes=200 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=10 bytes=1000 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 86399 ESTABLISHED src=2001:db8::1 dst=2001:db8::10 sport=52110 dport=80 packets=10 bytes=1000 src=2001:db8::10 dst=2001:db8::1 sport=80 dport=52110 packets=0 bytes=0 [ASSURED] mark=0 secmark=0 use=1
+`,
+		`tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=2 bytes=200 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=15 bytes=1500 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 86399 ESTABLISHED src=2001:db8::1 dst=2001:db8::10 sport=52110 dport=80 packets=15 bytes=1500 src=2001:db8::10 dst=2001:db8::1 sport=80 dport=52110 packets=0 bytes=0 [ASSURED] mark=0 secmark=0 use=1
+`,
+	}
+	locals := []string{"10.0.0.10", "2001:db8::10"}
+	web := conntracktest.Host{Locals: locals, Passive: []string{"80"}}
+	at := time.Now()
+	for _, v := range []Version{IPFIX, NetFlowV9} {
+		e, err := Dial(ln.LocalAddr().String(), v, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, entries := range rounds {
+			flows := web.Parse(t, entries)
+			if err := e.Export(flows, locals, at.Add(time.Duration(i)*10*time.Second)); err != nil {
+				t.Fatalf("version %d: should not raise error: %v", v, err)
+			}
+		}
+		e.Close()
+
+		buf := make([]byte, 65536)
+		ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := ln.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("version %d: the collector should receive the message: %v", v, err)
+		}
+		c := decode(t, buf[:n])
+		if c.version != uint16(v) {
+			t.Errorf("version should be %d, not %d", v, c.version)
+		}
+		// the inbound deltas of the active IPv4 flow and the passive IPv6 flow.
+		if len(c.records) != 2 {
+			t.Fatalf("version %d: the number of the records should be 2, not %d", v, len(c.records))
+		}
+		r := c.records[0]
+		if src := net.IP(r[0:4]); !src.Equal(net.ParseIP("10.0.1.10")) {
+			t.Errorf("version %d: source should be 10.0.1.10, not %v", v, src)
+		}
+		if port := binary.BigEndian.Uint16(r[8:]); port != 3306 {
+			t.Errorf("version %d: source port should be 3306, not %d", v, port)
+		}
+		if octets := binary.BigEndian.Uint64(r[13:]); octets != 500 {
+			t.Errorf("version %d: octets should be 500, not %d", v, octets)
+		}
+		if src := net.IP(c.records[1][0:16]); !src.Equal(net.ParseIP("2001:db8::1")) {
+			t.Errorf("version %d: source should be 2001:db8::1, not %v", v, src)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+// object are the subset of the Pod, Service and Endpoints resources.
+type object struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		ClusterIP   string   `json:"clusterIP"`
+		ClusterIPs  []string `json:"clusterIPs"`
+		HostNetwork bool     `json:"hostNetwork"`
+	} `json:"spec"`
+	Status struct {
+		PodIP  string `json:"podIP"`
+		PodIPs []struct {
+			IP string `json:"ip"`
+		} `json:"podIPs"`
+	} `json:"status"`
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []struct {
+			Port int `json:"port"`
+		} `json:"ports"`
+	} `json:"subsets"`
+}
+
+func (o *object) name() string {
+	return o.Metadata.Namespace + "/" + o.Metadata.Name
+}
+
+// list are the output of `kubectl get pods,svc,endpoints -o json` or the kubelet pods.
+type list struct {
+	Kind  string   `json:"kind"`
+	Items []object `json:"items"`
+}
+
+// Names maps the addresses of Pods and Services into their names.
+// eg. pod:default/web-5f1c2d3e4f-abcde, svc:default/web
+type Names struct {
+	addrs map[string]string
+	// endpoints maps the Pod endpoints "<addr>:<port>" into the Service name.
+	endpoints map[string]string
+}
+
+// NewNames creates an empty Names.
+func NewNames() *Names {
+	return &Names{
+		addrs:     map[string]string{},
+		endpoints: map[string]string{},
+	}
+}
+
+// Load loads the Pods, Services and Endpoints from the JSON list
+// such as `kubectl get pods,svc,endpoints -o json` or the kubelet `/pods`.
+func (n *Names) Load(r io.Reader) error {
+	var l list
+	if err := json.NewDecoder(r).Decode(&l); err != nil {
+		return fmt.Errorf("failed to decode kubernetes objects: %v", err)
+	}
+	for _, o := range l.Items {
+		kind := o.Kind
+		if kind == "" && l.Kind == "PodList" {
+			kind = "Pod" // the items of the kubelet pods have no kind
+		}
+		switch kind {
+		case "Pod":
+			if o.Spec.HostNetwork {
+				continue // the address are the node's one
+			}
+			ips := []string{o.Status.PodIP}
+			for _, ip := range o.Status.PodIPs {
+				ips = append(ips, ip.IP)
+			}
+			n.add(ips, "pod:"+o.name())
+		case "Service":
+			n.add(append([]string{o.Spec.ClusterIP}, o.Spec.ClusterIPs...), "svc:"+o.name())
+		case "Endpoints":
+			for _, subset := range o.Subsets {
+				for _, addr := range subset.Addresses {
+					for _, port := range subset.Ports {
+						n.endpoints[net.JoinHostPort(addr.IP, fmt.Sprintf("%d", port.Port))] = "svc:" + o.name()
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (n *Names) add(ips []string, name string) {
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			continue // empty or "None" of headless Services
+		}
+		n.addrs[ip] = name
+	}
+}
+
+// Lookup returns the name of addr or "" if unknown.
+func (n *Names) Lookup(addr string) string {
+	return n.addrs[addr]
+}
+
+// LearnClusterIPs maps the virtual IPs that are translated by DNAT into the
+// Service endpoints, such as the ClusterIPs of kube-proxy, into the Service name.
+func (n *Names) LearnClusterIPs(flows conntrack.HostFlows) {
+	for _, flow := range flows {
+		if flow.NAT == nil || flow.NAT.DNAT == nil {
+			continue
+		}
+		pre, post := flow.NAT.DNAT.Pre, flow.NAT.DNAT.Post
+		if _, ok := n.addrs[pre.Addr]; ok {
+			continue
+		}
+		if name, ok := n.endpoints[net.JoinHostPort(post.Addr, post.Port)]; ok {
+			n.addrs[pre.Addr] = name
+		}
+	}
+}
+
+// Resolver returns the function to resolve an address into the name,
+// which falls back to fallback if unknown. fallback can be nil.
+func (n *Names) Resolver(fallback func(string) string) func(string) string {
+	return func(addr string) string {
+		if name := n.Lookup(addr); name != "" {
+			return name
+		}
+		if fallback == nil {
+			return addr
+		}
+		return fallback(addr)
+	}
+}
@@ -0,0 +1,86 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+var state = `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {
+      "kind": "Pod",
+      "metadata": {"name": "web-5f1c2d3e4f-abcde", "namespace": "default"},
+      "spec": {},
+      "status": {"podIP": "10.244.1.5", "podIPs": [{"ip": "10.244.1.5"}]}
+    },
+    {
+      "kind": "Pod",
+      "metadata": {"name": "kube-proxy-xyz", "namespace": "kube-system"},
+      "spec": {"hostNetwork": true},
+      "status": {"podIP": "10.0.0.10"}
+    },
+    {
+      "kind": "Service",
+      "metadata": {"name": "db", "namespace": "default"},
+      "spec": {"clusterIP": "10.96.0.20"}
+    },
+    {
+      "kind": "Service",
+      "metadata": {"name": "headless", "namespace": "default"},
+      "spec": {"clusterIP": "None"}
+    },
+    {
+      "kind": "Endpoints",
+      "metadata": {"name": "web", "namespace": "default"},
+      "subsets": [{"addresses": [{"ip": "10.244.1.5"}], "ports": [{"port": 8080}]}]
+    }
+  ]
+}`
+
+func TestNames(t *testing.T) {
+	names := NewNames()
+	if err := names.Load(strings.NewReader(state)); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	flows := conntrack.HostFlows{
+		"web": &conntrack.HostFlow{
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: "10.96.0.10", Port: "80"},
+			NAT: &conntrack.NAT{
+				Type: conntrack.NATDestination,
+				DNAT: &conntrack.Translation{
+					Pre:  &conntrack.AddrPort{Addr: "10.96.0.10", Port: "80"},
+					Post: &conntrack.AddrPort{Addr: "10.244.1.5", Port: "8080"},
+				},
+			},
+			Stat: &conntrack.HostFlowStat{},
+		},
+	}
+	names.LearnClusterIPs(flows)
+
+	tests := []struct {
+		addr string
+		name string
+	}{
+		{"10.244.1.5", "pod:default/web-5f1c2d3e4f-abcde"},
+		{"10.0.0.10", ""},
+		{"10.96.0.20", "svc:default/db"},
+		{"10.96.0.10", "svc:default/web"},
+		{"None", ""},
+	}
+	for _, tt := range tests {
+		if name := names.Lookup(tt.addr); name != tt.name {
+			t.Errorf("Lookup(%q) == %q, not %q", tt.addr, name, tt.name)
+		}
+	}
+
+	resolve := names.Resolver(nil)
+	if got := resolve("10.0.1.10"); got != "10.0.1.10" {
+		t.Errorf("resolve should return the address itself if unknown, not %q", got)
+	}
+}
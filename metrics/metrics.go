@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+// Measurement are the name of the points.
+const Measurement = "lsconntrack"
+
+// Point are the tagged stat of a host flow at a time.
+type Point struct {
+	Time time.Time
+	// Tags are host, netns, direction, local, peer, port, nat and proto. The empty tags are omitted.
+	Tags   map[string]string
+	Fields []Field
+}
+
+// Field are the named value of a point.
+type Field struct {
+	Name  string
+	Value int64
+}
+
+// Points returns the points of the flows at the time, sorted by the unique key.
+// The flows merged from many hosts are tagged by their own hosts instead of host.
+// The tags distinguish the flows as well as their unique keys so that no point overwrites another.
+func Points(flows conntrack.HostFlows, host string, at time.Time) []*Point {
+	points := make([]*Point, 0, len(flows))
+	for _, flow := range flows.List() {
+		h := host
+		if flow.Host != "" {
+			h = flow.Host
+		}
+		s := flow.Stat
+		points = append(points, &Point{
+			Time: at,
+			Tags: map[string]string{
+				"host":      h,
+				"netns":     flow.Netns,
+				"direction": flow.Direction.String(),
+				"local":     LocalTag(flow),
+				"peer":      flow.Peer.Addr,
+				"port":      PortTag(flow),
+				"nat":       NATTag(flow),
+				"proto":     "tcp",
+			},
+			Fields: []Field{
+				{"in_bytes", s.TotalInboundBytes},
+				{"out_bytes", s.TotalOutboundBytes},
+				{"in_packets", s.TotalInboundPackets},
+				{"out_packets", s.TotalOutboundPackets},
+				{"connections", s.TotalConnections},
+			},
+		})
+	}
+	return points
+}
+
+// PortTag returns the port of the flow, which are the peer port on FlowActive and FlowForwarded,
+// and the local port on FlowPassive.
+func PortTag(flow *conntrack.HostFlow) string {
+	if flow.Direction == conntrack.FlowPassive {
+		return flow.Local.Port
+	}
+	return flow.Peer.Port
+}
+
+// LocalTag returns the local endpoint of the flow, which are the owner such as a container
+// or the client on FlowForwarded. It is empty for "localhost".
+func LocalTag(flow *conntrack.HostFlow) string {
+	if flow.Local.Addr == "localhost" {
+		return ""
+	}
+	return flow.Local.Addr
+}
+
+// NATTag returns the address translations of the flow, which is empty if not translated.
+func NATTag(flow *conntrack.HostFlow) string {
+	if flow.NAT == nil {
+		return ""
+	}
+	return flow.NAT.String()
+}
+
+// TagKeys returns the keys of the non-empty tags in lexical order.
+func (p *Point) TagKeys() []string {
+	keys := make([]string, 0, len(p.Tags))
+	for k, v := range p.Tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// WriteInflux writes the points in InfluxDB line protocol with the nanosecond timestamps.
+func WriteInflux(w io.Writer, points []*Point) error {
+	var b strings.Builder
+	for _, p := range points {
+		b.WriteString(Measurement)
+		for _, k := range p.TagKeys() {
+			fmt.Fprintf(&b, ",%s=%s", k, influxEscaper.Replace(p.Tags[k]))
+		}
+		for i, f := range p.Fields {
+			sep := ","
+			if i == 0 {
+				sep = " "
+			}
+			fmt.Fprintf(&b, "%s%s=%di", sep, f.Name, f.Value)
+		}
+		fmt.Fprintf(&b, " %d\n", p.Time.UnixNano())
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var graphiteEscaper = strings.NewReplacer(";", "_", "~", "_", " ", "_")
+
+// WriteGraphite writes the points in Graphite plaintext protocol with the tags,
+// such as 'lsconntrack.in_bytes;direction=active;peer=10.0.1.10;port=3306;proto=tcp 1024 1500000000'.
+func WriteGraphite(w io.Writer, points []*Point) error {
+	var b strings.Builder
+	for _, p := range points {
+		var tags string
+		for _, k := range p.TagKeys() {
+			tags += ";" + k + "=" + graphiteEscaper.Replace(p.Tags[k])
+		}
+		for _, f := range p.Fields {
+			fmt.Fprintf(&b, "%s.%s%s %d %d\n", Measurement, f.Name, tags, f.Value, p.Time.Unix())
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
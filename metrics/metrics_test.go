@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/conntrack/conntracktest"
+)
+
+func TestPoints(t *testing.T) {
+	web := conntracktest.Web
+	web.Owners = &conntrack.Owners{Sockets: map[string]string{"10.0.0.10:41143": "systemd:app.service"}}
+	tests := []struct {
+		desc string
+		line string
+		tags map[string]string
+	}{
+		{
+			desc: "active",
+			line: "tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41144 dport=3306 packets=2 bytes=200 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41144 packets=3 bytes=300 [ASSURED] mark=0 secmark=0 use=1",
+			tags: map[string]string{"host": "db-1", "netns": "", "direction": "active", "local": "", "peer": "10.0.1.10", "port": "3306", "nat": "", "proto": "tcp"},
+		},
+		{
+			desc: "owner",
+			line: "tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=2 bytes=200 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=3 bytes=300 [ASSURED] mark=0 secmark=0 use=1",
+			tags: map[string]string{"host": "db-1", "netns": "", "direction": "active", "local": "systemd:app.service", "peer": "10.0.1.10", "port": "3306", "nat": "", "proto": "tcp"},
+		},
+		{
+			desc: "dnat",
+			line: "tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.96.0.10 sport=41145 dport=3306 packets=2 bytes=200 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41145 packets=3 bytes=300 [ASSURED] mark=0 secmark=0 use=1",
+			tags: map[string]string{"host": "db-1", "netns": "", "direction": "active", "local": "", "peer": "10.96.0.10", "port": "3306", "nat": "dnat 10.96.0.10:3306->10.0.1.10:3306", "proto": "tcp"},
+		},
+		{
+			desc: "passive",
+			line: "tcp      6 86399 ESTABLISHED src=10.0.2.10 dst=10.0.0.10 sport=52110 dport=80 packets=5 bytes=500 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=52110 packets=4 bytes=400 [ASSURED] mark=0 secmark=0 use=1",
+			tags: map[string]string{"host": "db-1", "netns": "", "direction": "passive", "local": "", "peer": "10.0.2.10", "port": "80", "nat": "", "proto": "tcp"},
+		},
+	}
+	for _, tc := range tests {
+		flows := web.Parse(t, tc.line)
+		points := Points(flows, "db-1", time.Unix(1500000000, 0))
+		if len(points) != 1 {
+			t.Fatalf("desc: %q, the number of the points should be 1, not %d", tc.desc, len(points))
+		}
+		if !reflect.DeepEqual(points[0].Tags, tc.tags) {
+			t.Errorf("desc: %q, tags should be %v, not %v", tc.desc, tc.tags, points[0].Tags)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	entries := `tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=2 bytes=200 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=3 bytes=300 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 86399 ESTABLISHED src=10.0.2.10 dst=10.0.0.10 sport=52110 dport=80 packets=5 bytes=500 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=52110 packets=4 bytes=400 [ASSURED] mark=0 secmark=0 use=1
+`
+	flows := conntracktest.Web.Parse(t, entries)
+	// the names are escaped.
+	flows = flows.Resolved(func(addr string) string {
+		if addr == "10.0.2.10" {
+			return "web 1"
+		}
+		return addr
+	})
+	tests := []struct {
+		desc     string
+		write    func(*bytes.Buffer, []*Point) error
+		host     string
+		expected string
+	}{
+		{
+			desc: "influx",
+			write: func(b *bytes.Buffer, points []*Point) error {
+				return WriteInflux(b, points)
+			},
+			host: "db-1",
+			expected: `lsconntrack,direction=active,host=db-1,peer=10.0.1.10,port=3306,proto=tcp in_bytes=300i,out_bytes=200i,in_packets=3i,out_packets=2i,connections=1i 1500000000000000000
+lsconntrack,direction=passive,host=db-1,peer=web\ 1,port=80,proto=tcp in_bytes=500i,out_bytes=400i,in_packets=5i,out_packets=4i,connections=1i 1500000000000000000
+`,
+		},
+		{
+			desc: "graphite",
+			write: func(b *bytes.Buffer, points []*Point) error {
+				return WriteGraphite(b, points[:1])
+			},
+			expected: `lsconntrack.in_bytes;direction=active;peer=10.0.1.10;port=3306;proto=tcp 300 1500000000
+lsconntrack.out_bytes;direction=active;peer=10.0.1.10;port=3306;proto=tcp 200 1500000000
+lsconntrack.in_packets;direction=active;peer=10.0.1.10;port=3306;proto=tcp 3 1500000000
+lsconntrack.out_packets;direction=active;peer=10.0.1.10;port=3306;proto=tcp 2 1500000000
+lsconntrack.connections;direction=active;peer=10.0.1.10;port=3306;proto=tcp 1 1500000000
+`,
+		},
+	}
+	for _, tc := range tests {
+		var out bytes.Buffer
+		if err := tc.write(&out, Points(flows, tc.host, time.Unix(1500000000, 0))); err != nil {
+			t.Fatalf("desc: %q, should not raise error: %v", tc.desc, err)
+		}
+		if got := out.String(); got != tc.expected {
+			t.Errorf("desc: %q, should write %q, not %q", tc.desc, tc.expected, got)
+		}
+	}
+}
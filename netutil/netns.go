@@ -0,0 +1,186 @@
+package netutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// NetnsRunDir are the directory where `ip netns` mounts the named network namespaces.
+var NetnsRunDir = "/var/run/netns"
+
+// Netns represents a network namespace to inspect.
+type Netns struct {
+	// Name are the label of the namespace. eg. host, blue, container:3f4e8a9c2b1d, pid:1234
+	Name string
+	// Path are the namespace file to enter.
+	Path string
+}
+
+// NetnsPath returns the namespace file path of NAME, PATH or pid:N.
+func NetnsPath(spec string) (string, error) {
+	switch {
+	case spec == "":
+		return "", fmt.Errorf("empty network namespace")
+	case strings.HasPrefix(spec, "pid:"):
+		pid, err := strconv.Atoi(strings.TrimPrefix(spec, "pid:"))
+		if err != nil {
+			return "", fmt.Errorf("%s is not pid", spec)
+		}
+		return filepath.Join(ProcPath, strconv.Itoa(pid), "ns", "net"), nil
+	case strings.Contains(spec, "/"):
+		return spec, nil
+	}
+	return filepath.Join(NetnsRunDir, spec), nil
+}
+
+// NetnsList returns the current network namespace, the named ones in NetnsRunDir
+// and the ones which the running processes are in, without duplication.
+func NetnsList() ([]Netns, error) {
+	self := filepath.Join(ProcPath, "self", "ns", "net")
+	ino, err := nsInode(self)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[uint64]bool{ino: true}
+	nslist := []Netns{{Name: "host", Path: self}}
+
+	names, err := readDirNames(NetnsRunDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(NetnsRunDir, name)
+		ino, err := nsInode(path)
+		if err != nil || seen[ino] {
+			continue
+		}
+		seen[ino] = true
+		nslist = append(nslist, Netns{Name: name, Path: path})
+	}
+
+	procnslist, err := ProcNetnsList()
+	if err != nil {
+		return nil, err
+	}
+	for _, ns := range procnslist {
+		path := filepath.Join(ProcPath, strconv.Itoa(ns.Pid), "ns", "net")
+		ino, err := nsInode(path)
+		if err != nil || seen[ino] {
+			continue
+		}
+		seen[ino] = true
+		name, err := CgroupOwner(ns.Pid)
+		if err != nil || name == "" {
+			name = fmt.Sprintf("pid:%d", ns.Pid)
+		}
+		nslist = append(nslist, Netns{Name: name, Path: path})
+	}
+	return nslist, nil
+}
+
+// ProcNetns represents a network namespace found through a process in it.
+type ProcNetns struct {
+	// ID are the namespace identifier. eg. net:[4026532285]
+	ID string
+	// Pid are one of the processes in the namespace.
+	Pid int
+}
+
+// ProcNetnsList returns the network namespaces other than the current one,
+// which the running processes are in.
+func ProcNetnsList() ([]ProcNetns, error) {
+	self, err := os.Readlink(filepath.Join(ProcPath, "self", "ns", "net"))
+	if err != nil {
+		return nil, err
+	}
+	names, err := readDirNames(ProcPath)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{self: true}
+	nslist := []ProcNetns{}
+	for _, name := range names {
+		pid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		id, err := os.Readlink(filepath.Join(ProcPath, name, "ns", "net"))
+		if err != nil || seen[id] {
+			continue // the process has gone or belongs to a known namespace
+		}
+		seen[id] = true
+		nslist = append(nslist, ProcNetns{ID: id, Pid: pid})
+	}
+	return nslist, nil
+}
+
+// ThreadProcNetPath returns the procfs net directory of the calling thread,
+// which reflects the network namespace entered by RunInNetns unlike '/proc/net'.
+func ThreadProcNetPath() string {
+	return filepath.Join(ProcPath, "thread-self", "net")
+}
+
+// RunInNetns runs fn on an OS thread that has entered the network namespace of path.
+// fn must not start goroutines that depend on the namespace.
+func RunInNetns(path string, fn func() error) error {
+	ns, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer ns.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		// The thread is left locked on failure so that it terminates with
+		// the goroutine instead of being reused in the foreign namespace.
+		runtime.LockOSThread()
+		orig, err := os.Open(filepath.Join(ProcPath, "thread-self", "ns", "net"))
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer orig.Close()
+		if err := unix.Setns(int(ns.Fd()), unix.CLONE_NEWNET); err != nil {
+			errCh <- fmt.Errorf("failed to enter %s: %v", path, err)
+			return
+		}
+		ferr := fn()
+		if err := unix.Setns(int(orig.Fd()), unix.CLONE_NEWNET); err != nil {
+			errCh <- fmt.Errorf("failed to leave %s: %v", path, err)
+			return
+		}
+		runtime.UnlockOSThread()
+		errCh <- ferr
+	}()
+	return <-errCh
+}
+
+func nsInode(path string) (uint64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("failed to stat %s", path)
+	}
+	return st.Ino, nil
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
@@ -0,0 +1,26 @@
+package netutil
+
+import "testing"
+
+func TestNetnsPath(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		err bool
+	}{
+		{"blue", "/var/run/netns/blue", false},
+		{"/run/docker/netns/3f4e8a9c2b1d", "/run/docker/netns/3f4e8a9c2b1d", false},
+		{"pid:1234", "/proc/1234/ns/net", false},
+		{"pid:abc", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		out, err := NetnsPath(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("NetnsPath(%q) should return error: %v, got %v", tt.in, tt.err, err)
+		}
+		if out != tt.out {
+			t.Errorf("NetnsPath(%q) == %q, not %q", tt.in, out, tt.out)
+		}
+	}
+}
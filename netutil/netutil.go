@@ -1,9 +1,14 @@
 package netutil
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	gnet "github.com/shirou/gopsutil/net"
@@ -39,6 +44,87 @@ func LocalListeningPorts() ([]string, error) {
 	return ports, nil
 }
 
+// ParseListeningPorts parses the listening ports, one port per line,
+// or the output of `ss -tln` or `netstat -tln`, with or without the columns such as Netid and PID/Program name.
+// The UDP sockets are skipped.
+// -----------------------------------------------------------------------------------
+// [y_uuki@host ~]$ ss -tln
+// State      Recv-Q Send-Q Local Address:Port               Peer Address:Port
+// LISTEN     0      128               *:22                            *:*
+// LISTEN     0      128              :::80                           :::*
+// [y_uuki@host ~]$ netstat -tlnp
+// Proto Recv-Q Send-Q Local Address           Foreign Address         State       PID/Program name
+// tcp        0      0 0.0.0.0:22              0.0.0.0:*               LISTEN      1234/sshd
+func ParseListeningPorts(r io.Reader) ([]string, error) {
+	ports := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || isListeningHeader(fields[0]) || isUDPSocket(fields) {
+			continue
+		}
+		if len(fields) == 1 {
+			if _, err := strconv.Atoi(fields[0]); err != nil {
+				return nil, fmt.Errorf("unexpected line: %s", line)
+			}
+			ports = append(ports, fields[0])
+			continue
+		}
+		addr := listeningAddr(fields)
+		if addr == "" {
+			return nil, fmt.Errorf("unexpected line: %s", line)
+		}
+		port := addr[strings.LastIndex(addr, ":")+1:]
+		if _, err := strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("unexpected line: %s", line)
+		}
+		ports = append(ports, port)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ports, nil
+}
+
+// isListeningHeader returns whether the first field is of the header lines of ss or netstat.
+func isListeningHeader(field string) bool {
+	switch field {
+	case "State", "Netid", "Proto", "Active":
+		return true
+	}
+	return false
+}
+
+// isUDPSocket returns whether the fields are of a UDP socket, which are printed by `ss -tuln` or `netstat -tuln`.
+func isUDPSocket(fields []string) bool {
+	return strings.HasPrefix(fields[0], "udp") || fields[0] == "UNCONN" || (len(fields) > 1 && fields[1] == "UNCONN")
+}
+
+// listeningAddr returns the local address of the fields in LISTEN state,
+// or the empty string if the fields are not in a known format.
+// The local address follows LISTEN and the queues in ss, and precedes the foreign address and LISTEN in netstat.
+func listeningAddr(fields []string) string {
+	for i, field := range fields {
+		if field != "LISTEN" {
+			continue
+		}
+		if i+3 < len(fields) && isNumber(fields[i+1]) && isNumber(fields[i+2]) {
+			return fields[i+3]
+		}
+		if i >= 2 {
+			return fields[i-2]
+		}
+		return ""
+	}
+	return ""
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
 // ResolveAddr lookup first hostname from IP Address.
 func ResolveAddr(addr string) string {
 	hostnames, _ := net.LookupAddr(addr)
@@ -65,6 +151,60 @@ func LocalIPAddrs() ([]string, error) {
 	return addrStrings, nil
 }
 
+// PortRange represents the range of ports.
+type PortRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// Contains returns whether port is in the range.
+func (r *PortRange) Contains(port string) bool {
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return false
+	}
+	return r.Min <= p && p <= r.Max
+}
+
+// EphemeralPortRange returns the local port range for the outbound connections.
+// eg. 32768	60999
+func EphemeralPortRange() (*PortRange, error) {
+	b, err := ioutil.ReadFile(filepath.Join(ProcPath, "sys", "net", "ipv4", "ip_local_port_range"))
+	if err != nil {
+		return nil, err
+	}
+	return ParsePortRange(string(b))
+}
+
+// KernelRelease returns the release of the running kernel.
+// eg. 4.15.0-112-generic
+func KernelRelease() (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(ProcPath, "sys", "kernel", "osrelease"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// ParsePortRange parses the port range such as "32768 60999" or "32768-60999".
+func ParsePortRange(s string) (*PortRange, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '-' || r == ' ' || r == '\t' || r == '\n'
+	})
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("unexpected port range: %q", s)
+	}
+	min, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected port range: %q", s)
+	}
+	max, err := strconv.Atoi(fields[1])
+	if err != nil || min > max {
+		return nil, fmt.Errorf("unexpected port range: %q", s)
+	}
+	return &PortRange{Min: min, Max: max}, nil
+}
+
 var (
 	// IPConntrackPath are ip_conntrack path.
 	IPConntrackPath = "/proc/net/ip_conntrack" // old kernel
@@ -81,3 +221,14 @@ func FindConntrackPath() string {
 	}
 	return ""
 }
+
+// FindConntrackPathIn returns the conntrack proc path in the procfs net directory such as '/proc/<pid>/net' if exists.
+func FindConntrackPathIn(dir string) string {
+	for _, path := range []string{IPConntrackPath, NFConntrackPath} {
+		path = filepath.Join(dir, filepath.Base(path))
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
@@ -1,6 +1,10 @@
 package netutil
 
-import "testing"
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestLocalIPAddrss(t *testing.T) {
 	addrs, err := LocalIPAddrs()
@@ -11,3 +15,101 @@ func TestLocalIPAddrss(t *testing.T) {
 		t.Error("localIPAddrs() should not be len == 0")
 	}
 }
+
+func TestParseListeningPorts(t *testing.T) {
+	tests := []struct {
+		desc string
+		in   string
+		out  []string
+		err  bool
+	}{
+		{
+			desc: "list",
+			in:   "# ports\n80\n443\n\n",
+			out:  []string{"80", "443"},
+		},
+		{
+			desc: "ss",
+			in: `State      Recv-Q Send-Q Local Address:Port               Peer Address:Port
+LISTEN     0      128               *:22                            *:*
+LISTEN     0      128              :::80                           :::*
+`,
+			out: []string{"22", "80"},
+		},
+		{
+			desc: "netstat",
+			in: `Active Internet connections (only servers)
+Proto Recv-Q Send-Q Local Address               Foreign Address             State
+tcp        0      0 0.0.0.0:199                 0.0.0.0:*                   LISTEN
+tcp        0      0 :::8081                     :::*                        LISTEN
+`,
+			out: []string{"199", "8081"},
+		},
+		{
+			desc: "netstat with programs",
+			in: `Active Internet connections (only servers)
+Proto Recv-Q Send-Q Local Address           Foreign Address         State       PID/Program name
+tcp        0      0 0.0.0.0:22              0.0.0.0:*               LISTEN      1234/sshd
+tcp6       0      0 :::443                  :::*                    LISTEN      5678/nginx: master
+udp        0      0 0.0.0.0:68              0.0.0.0:*                           910/dhclient
+`,
+			out: []string{"22", "443"},
+		},
+		{
+			desc: "ss with netid",
+			in: `Netid State  Recv-Q Send-Q Local Address:Port Peer Address:Port Process
+udp   UNCONN 0      0      0.0.0.0:68         0.0.0.0:*
+tcp   LISTEN 0      128    0.0.0.0:22         0.0.0.0:*     users:(("sshd",pid=1234,fd=3))
+tcp   LISTEN 0      511    [::]:80            [::]:*
+`,
+			out: []string{"22", "80"},
+		},
+		{
+			desc: "invalid",
+			in:   "http\n",
+			err:  true,
+		},
+		{
+			desc: "unknown format",
+			in:   "tcp 0.0.0.0:22 ESTABLISHED\n",
+			err:  true,
+		},
+	}
+	for _, tc := range tests {
+		out, err := ParseListeningPorts(strings.NewReader(tc.in))
+		if (err != nil) != tc.err {
+			t.Errorf("desc: %q, should return error: %v, got %v", tc.desc, tc.err, err)
+			continue
+		}
+		if !tc.err && !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("desc: %q, ports should be %v, not %v", tc.desc, tc.out, out)
+		}
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *PortRange
+	}{
+		{"32768\t60999\n", &PortRange{Min: 32768, Max: 60999}},
+		{"1024-65535", &PortRange{Min: 1024, Max: 65535}},
+		{"60999 32768", nil},
+		{"32768", nil},
+	}
+	for _, tt := range tests {
+		out, err := ParsePortRange(tt.in)
+		if tt.out == nil {
+			if err == nil {
+				t.Errorf("ParsePortRange(%q) should raise error", tt.in)
+			}
+			continue
+		}
+		if err != nil || *out != *tt.out {
+			t.Errorf("ParsePortRange(%q) == %v, %v, not %v", tt.in, out, err, tt.out)
+		}
+	}
+	if !(&PortRange{Min: 32768, Max: 60999}).Contains("41143") {
+		t.Error("32768-60999 should contain 41143")
+	}
+}
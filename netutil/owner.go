@@ -0,0 +1,222 @@
+package netutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gnet "github.com/shirou/gopsutil/net"
+)
+
+// ProcPath are the procfs mount point.
+var ProcPath = "/proc"
+
+var containerIDRegexp = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// CgroupOwner returns the name of the container, systemd unit or cgroup
+// that the process belongs to.
+// eg. container:3f4e8a9c2b1d, systemd:nginx.service, cgroup:/batch/job1
+func CgroupOwner(pid int) (string, error) {
+	f, err := os.Open(filepath.Join(ProcPath, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return parseCgroupOwner(f), nil
+}
+
+// parseCgroupOwner parses '/proc/<pid>/cgroup'.
+// -----------------------------------------------------------------------------------
+// 12:memory:/docker/3f4e8a9c2b1d...
+// 11:pids:/kubepods/burstable/pod5f1c.../3f4e8a9c2b1d...
+// 1:name=systemd:/system.slice/nginx.service
+// 0::/system.slice/docker-3f4e8a9c2b1d....scope
+func parseCgroupOwner(r io.Reader) string {
+	var unit, path string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 || fields[2] == "/" {
+			continue
+		}
+		if id := containerIDRegexp.FindString(fields[2]); id != "" {
+			return "container:" + id[:12]
+		}
+		base := filepath.Base(fields[2])
+		if unit == "" && (strings.HasSuffix(base, ".service") || strings.HasSuffix(base, ".scope")) {
+			unit = base
+		}
+		if path == "" {
+			path = fields[2]
+		}
+	}
+	if unit != "" {
+		return "systemd:" + unit
+	}
+	if path != "" {
+		return "cgroup:" + path
+	}
+	return ""
+}
+
+// NetnsIPAddrs returns the IPv4 addresses assigned in the network namespace of the process.
+func NetnsIPAddrs(pid int) ([]string, error) {
+	f, err := os.Open(filepath.Join(ProcPath, strconv.Itoa(pid), "net", "fib_trie"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseFibTrieLocalAddrs(f)
+}
+
+// parseFibTrieLocalAddrs parses '/proc/<pid>/net/fib_trie' and returns the local addresses.
+// -----------------------------------------------------------------------------------
+// Local:
+//
+//	+-- 0.0.0.0/0 1 0 0
+//	   +-- 10.0.1.0/24 2 0 2
+//	      |-- 10.0.1.10
+//	         /32 host LOCAL
+func parseFibTrieLocalAddrs(r io.Reader) ([]string, error) {
+	var (
+		last  string
+		addrs []string
+	)
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "|-- ") {
+			last = strings.TrimPrefix(line, "|-- ")
+			continue
+		}
+		if line != "/32 host LOCAL" || seen[last] {
+			continue
+		}
+		seen[last] = true
+		if ip := net.ParseIP(last); ip != nil && !ip.IsLoopback() {
+			addrs = append(addrs, last)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return addrs, nil
+}
+
+// NetnsListeningPorts returns the listening TCP ports in the network namespace of the process.
+func NetnsListeningPorts(pid int) ([]string, error) {
+	return ListeningPortsIn(filepath.Join(ProcPath, strconv.Itoa(pid), "net"))
+}
+
+// ListeningPortsIn returns the listening TCP ports in the procfs net directory such as '/proc/<pid>/net'.
+func ListeningPortsIn(dir string) ([]string, error) {
+	ports := []string{}
+	for _, name := range []string{"tcp", "tcp6"} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // ipv6 disabled
+			}
+			return nil, err
+		}
+		p, err := parseProcNetListeningPorts(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, p...)
+	}
+	return ports, nil
+}
+
+// parseProcNetListeningPorts parses '/proc/<pid>/net/tcp' and returns the ports in LISTEN state.
+// -----------------------------------------------------------------------------------
+//
+//	sl  local_address rem_address   st tx_queue rx_queue ...
+//	 0: 00000000:0050 00000000:0000 0A 00000000:00000000 ...
+func parseProcNetListeningPorts(r io.Reader) ([]string, error) {
+	ports := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != "0A" { // 0A are TCP_LISTEN
+			continue
+		}
+		i := strings.LastIndex(fields[1], ":")
+		if i < 0 {
+			continue
+		}
+		port, err := strconv.ParseUint(fields[1][i+1:], 16, 16)
+		if err != nil {
+			continue // header line
+		}
+		ports = append(ports, fmt.Sprintf("%d", port))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ports, nil
+}
+
+// ContainerOwners returns the addresses in other network namespaces, such as
+// containers, mapped to the owner name of the namespace, and the ports listened in them.
+func ContainerOwners() (map[string]string, []string, error) {
+	nslist, err := ProcNetnsList()
+	if err != nil {
+		return nil, nil, err
+	}
+	owners := map[string]string{}
+	ports := []string{}
+	for _, ns := range nslist {
+		addrs, err := NetnsIPAddrs(ns.Pid)
+		if err != nil {
+			continue // the process has gone
+		}
+		owner, err := CgroupOwner(ns.Pid)
+		if err != nil || owner == "" {
+			owner = "netns:" + ns.ID
+		}
+		for _, addr := range addrs {
+			owners[addr] = owner
+		}
+		p, err := NetnsListeningPorts(ns.Pid)
+		if err != nil {
+			continue
+		}
+		ports = append(ports, p...)
+	}
+	return owners, ports, nil
+}
+
+// SocketOwners returns the local TCP endpoints "<addr>:<port>" mapped to the
+// owner name of the process that opened the socket.
+func SocketOwners() (map[string]string, error) {
+	conns, err := gnet.Connections("tcp")
+	if err != nil {
+		return nil, err
+	}
+	owners := map[string]string{}
+	cache := map[int32]string{}
+	for _, conn := range conns {
+		if conn.Pid == 0 {
+			continue
+		}
+		owner, ok := cache[conn.Pid]
+		if !ok {
+			owner, _ = CgroupOwner(int(conn.Pid))
+			cache[conn.Pid] = owner
+		}
+		if owner == "" {
+			continue
+		}
+		owners[net.JoinHostPort(conn.Laddr.IP, fmt.Sprintf("%d", conn.Laddr.Port))] = owner
+	}
+	return owners, nil
+}
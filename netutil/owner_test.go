@@ -0,0 +1,90 @@
+package netutil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCgroupOwner(t *testing.T) {
+	tests := []struct {
+		desc string
+		in   string
+		out  string
+	}{
+		{
+			desc: "docker",
+			in:   "12:memory:/docker/3f4e8a9c2b1d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f\n",
+			out:  "container:3f4e8a9c2b1d",
+		},
+		{
+			desc: "kubernetes",
+			in:   "11:pids:/kubepods/burstable/pod5f1c2d3e-4f5a-6b7c-8d9e-0f1a2b3c4d5e/3f4e8a9c2b1d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f\n",
+			out:  "container:3f4e8a9c2b1d",
+		},
+		{
+			desc: "systemd",
+			in:   "2:cpu,cpuacct:/\n1:name=systemd:/system.slice/nginx.service\n",
+			out:  "systemd:nginx.service",
+		},
+		{
+			desc: "cgroup",
+			in:   "0::/batch/job1\n",
+			out:  "cgroup:/batch/job1",
+		},
+		{
+			desc: "root",
+			in:   "0::/\n",
+			out:  "",
+		},
+	}
+	for _, tc := range tests {
+		if out := parseCgroupOwner(strings.NewReader(tc.in)); out != tc.out {
+			t.Errorf("desc: %q, parseCgroupOwner should be %q, not %q", tc.desc, tc.out, out)
+		}
+	}
+}
+
+func TestParseFibTrieLocalAddrs(t *testing.T) {
+	in := `Main:
+  +-- 0.0.0.0/0 3 0 5
+     |-- 0.0.0.0
+        /0 universe UNICAST
+     +-- 10.0.1.0/24 2 0 2
+        |-- 10.0.1.0
+           /32 link BROADCAST
+           /24 link UNICAST
+        |-- 10.0.1.10
+           /32 host LOCAL
+     +-- 127.0.0.0/8 2 0 2
+        |-- 127.0.0.1
+           /32 host LOCAL
+Local:
+  +-- 0.0.0.0/0 3 0 5
+     +-- 10.0.1.0/24 2 0 2
+        |-- 10.0.1.10
+           /32 host LOCAL
+`
+	addrs, err := parseFibTrieLocalAddrs(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if !reflect.DeepEqual(addrs, []string{"10.0.1.10"}) {
+		t.Errorf("addrs should be [10.0.1.10], not %v", addrs)
+	}
+}
+
+func TestParseProcNetListeningPorts(t *testing.T) {
+	in := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 18620 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 18621 1 0000000000000000 100 0 0 10 0
+   2: 0A01000A:0050 0B01000A:D2F0 01 00000000:00000000 00:00000000 00000000     0        0 18622 1 0000000000000000 100 0 0 10 0
+`
+	ports, err := parseProcNetListeningPorts(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if !reflect.DeepEqual(ports, []string{"80", "3306"}) {
+		t.Errorf("ports should be [80 3306], not %v", ports)
+	}
+}
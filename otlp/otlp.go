@@ -0,0 +1,254 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/metrics"
+)
+
+// The types below are the subset of the OTLP metrics in the JSON encoding of protobuf,
+// in which the 64 bit integers are the strings.
+
+// MetricsData are the body of the export request.
+type MetricsData struct {
+	ResourceMetrics []*ResourceMetrics `json:"resourceMetrics"`
+}
+
+// ResourceMetrics are the metrics of a resource.
+type ResourceMetrics struct {
+	Resource     Resource        `json:"resource"`
+	ScopeMetrics []*ScopeMetrics `json:"scopeMetrics"`
+}
+
+// Resource are the entity producing the metrics.
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+// ScopeMetrics are the metrics of the instrumentation scope.
+type ScopeMetrics struct {
+	Scope   Scope     `json:"scope"`
+	Metrics []*Metric `json:"metrics"`
+}
+
+// Scope are the instrumentation scope.
+type Scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// Metric are the named sum or gauge.
+type Metric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Sum         *Sum   `json:"sum,omitempty"`
+	Gauge       *Gauge `json:"gauge,omitempty"`
+}
+
+// aggregationTemporalityDelta are AGGREGATION_TEMPORALITY_DELTA.
+const aggregationTemporalityDelta = 1
+
+// Sum are the data points of a sum.
+type Sum struct {
+	DataPoints             []*NumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                `json:"aggregationTemporality"`
+	IsMonotonic            bool               `json:"isMonotonic"`
+}
+
+// Gauge are the data points of a gauge.
+type Gauge struct {
+	DataPoints []*NumberDataPoint `json:"dataPoints"`
+}
+
+// NumberDataPoint are the integer value at a time.
+type NumberDataPoint struct {
+	Attributes        []KeyValue `json:"attributes"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsInt             string     `json:"asInt"`
+}
+
+// KeyValue are the attribute of the string value.
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue are the value of an attribute.
+type AnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func attr(key, value string) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{StringValue: value}}
+}
+
+func nanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// attributes returns the attributes of the data points of the flow, which distinguish
+// the flows in a resource as well as the tags of metrics.Points. The empty ones are omitted.
+func attributes(flow *conntrack.HostFlow) []KeyValue {
+	attrs := []KeyValue{attr("direction", flow.Direction.String())}
+	if local := metrics.LocalTag(flow); local != "" {
+		attrs = append(attrs, attr("local", local))
+	}
+	attrs = append(attrs, attr("peer", flow.Peer.Addr), attr("port", metrics.PortTag(flow)))
+	if nat := metrics.NATTag(flow); nat != "" {
+		attrs = append(attrs, attr("nat", nat))
+	}
+	return attrs
+}
+
+// metricDefs are the metrics of a host flow, which are the delta sums unless gauge.
+var metricDefs = []struct {
+	name, description, unit string
+	gauge                   bool
+	value                   func(s *conntrack.HostFlowStat) int64
+}{
+	{"lsconntrack.flow.inbound.bytes", "The bytes received from the peer", "By", false,
+		func(s *conntrack.HostFlowStat) int64 { return s.TotalInboundBytes }},
+	{"lsconntrack.flow.outbound.bytes", "The bytes sent to the peer", "By", false,
+		func(s *conntrack.HostFlowStat) int64 { return s.TotalOutboundBytes }},
+	{"lsconntrack.flow.inbound.packets", "The packets received from the peer", "{packet}", false,
+		func(s *conntrack.HostFlowStat) int64 { return s.TotalInboundPackets }},
+	{"lsconntrack.flow.outbound.packets", "The packets sent to the peer", "{packet}", false,
+		func(s *conntrack.HostFlowStat) int64 { return s.TotalOutboundPackets }},
+	{"lsconntrack.flow.connections", "The connections tracked", "{connection}", true,
+		func(s *conntrack.HostFlowStat) int64 { return s.TotalConnections }},
+}
+
+// Metrics returns the metrics of the host flows whose stats are the deltas since start, such as
+// those of conntrack.DeltaTracker, as the delta sums from start to at, and the connections as the gauges at the time.
+// The sums are omitted if start is zero, that is, on the first round.
+// The resources are the host and the network namespace, whose attributes are host.name and netns,
+// and the data points are attributed by direction, local, peer, port and nat.
+// The flows merged from many hosts are of their own hosts instead of host.
+func Metrics(deltas conntrack.HostFlows, host, version string, start, at time.Time) *MetricsData {
+	type resource struct {
+		host, netns string
+	}
+	byResource := map[resource][]*conntrack.HostFlow{}
+	var resources []resource
+	for _, flow := range deltas.List() {
+		r := resource{host, flow.Netns}
+		if flow.Host != "" {
+			r.host = flow.Host
+		}
+		if _, ok := byResource[r]; !ok {
+			resources = append(resources, r)
+		}
+		byResource[r] = append(byResource[r], flow)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].host != resources[j].host {
+			return resources[i].host < resources[j].host
+		}
+		return resources[i].netns < resources[j].netns
+	})
+
+	data := &MetricsData{ResourceMetrics: []*ResourceMetrics{}}
+	for _, r := range resources {
+		var attrs []KeyValue
+		if r.host != "" {
+			attrs = append(attrs, attr("host.name", r.host))
+		}
+		if r.netns != "" {
+			attrs = append(attrs, attr("netns", r.netns))
+		}
+		sm := &ScopeMetrics{Scope: Scope{Name: "lsconntrack", Version: version}}
+		for _, def := range metricDefs {
+			if !def.gauge && start.IsZero() {
+				continue
+			}
+			var points []*NumberDataPoint
+			for _, flow := range byResource[r] {
+				dp := &NumberDataPoint{
+					Attributes:   attributes(flow),
+					TimeUnixNano: nanos(at),
+					AsInt:        strconv.FormatInt(def.value(flow.Stat), 10),
+				}
+				if !def.gauge {
+					dp.StartTimeUnixNano = nanos(start)
+				}
+				points = append(points, dp)
+			}
+			m := &Metric{Name: def.name, Description: def.description, Unit: def.unit}
+			if def.gauge {
+				m.Gauge = &Gauge{DataPoints: points}
+			} else {
+				m.Sum = &Sum{DataPoints: points, AggregationTemporality: aggregationTemporalityDelta, IsMonotonic: true}
+			}
+			sm.Metrics = append(sm.Metrics, m)
+		}
+		data.ResourceMetrics = append(data.ResourceMetrics, &ResourceMetrics{
+			Resource:     Resource{Attributes: attrs},
+			ScopeMetrics: []*ScopeMetrics{sm},
+		})
+	}
+	return data
+}
+
+// metricsPath are the default path of the OTLP/HTTP metrics endpoint.
+const metricsPath = "/v1/metrics"
+
+// Exporter posts the host flows as the OTLP metrics in the JSON encoding over HTTP.
+type Exporter struct {
+	endpoint string
+	version  string
+	client   *http.Client
+	deltas   conntrack.DeltaTracker
+}
+
+// NewExporter returns the exporter to the collector at endpoint such as 'http://localhost:4318'.
+// The path are /v1/metrics unless endpoint has the path.
+func NewExporter(endpoint, version string) (*Exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%s is not http or https URL", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = metricsPath
+	}
+	return &Exporter{
+		endpoint: u.String(),
+		version:  version,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Export posts the metrics of the host flows since the previous round at the time.
+// The first round only posts the gauges.
+func (e *Exporter) Export(flows conntrack.HostFlows, host string, at time.Time) error {
+	deltas, start := e.deltas.Deltas(flows, at)
+	body, err := json.Marshal(Metrics(deltas, host, e.version, start, at))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
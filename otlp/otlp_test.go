@@ -0,0 +1,144 @@
+package otlp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/conntrack/conntracktest"
+)
+
+func TestMetrics(t *testing.T) {
+	entries := `tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.96.0.10 sport=41143 dport=3306 packets=2 bytes=200 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=3 bytes=300 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 86399 ESTABLISHED src=10.0.2.10 dst=10.0.0.10 sport=52110 dport=80 packets=5 bytes=500 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=52110 packets=4 bytes=400 [ASSURED] mark=0 secmark=0 use=1
+`
+	flows := conntracktest.Web.Parse(t, entries)
+	for _, flow := range flows {
+		if flow.Direction == conntrack.FlowPassive {
+			flow.Netns = "blue"
+		}
+	}
+	start, at := time.Unix(1500000000, 0), time.Unix(1500000060, 0)
+	data := Metrics(flows, "app-1", "0.1.0", start, at)
+	if len(data.ResourceMetrics) != 2 {
+		t.Fatalf("the number of the resources should be 2, not %d", len(data.ResourceMetrics))
+	}
+	tests := []struct {
+		desc       string
+		resource   []KeyValue
+		attributes []KeyValue
+		inBytes    string
+	}{
+		{
+			desc:       "host",
+			resource:   []KeyValue{attr("host.name", "app-1")},
+			attributes: []KeyValue{attr("direction", "active"), attr("peer", "10.96.0.10"), attr("port", "3306"), attr("nat", "dnat 10.96.0.10:3306->10.0.1.10:3306")},
+			inBytes:    "300",
+		},
+		{
+			desc:       "netns",
+			resource:   []KeyValue{attr("host.name", "app-1"), attr("netns", "blue")},
+			attributes: []KeyValue{attr("direction", "passive"), attr("peer", "10.0.2.10"), attr("port", "80")},
+			inBytes:    "500",
+		},
+	}
+	for i, tc := range tests {
+		rm := data.ResourceMetrics[i]
+		if !reflect.DeepEqual(rm.Resource.Attributes, tc.resource) {
+			t.Errorf("desc: %q, resource should be %v, not %v", tc.desc, tc.resource, rm.Resource.Attributes)
+		}
+		metrics := rm.ScopeMetrics[0].Metrics
+		m := metrics[0]
+		if m.Name != "lsconntrack.flow.inbound.bytes" || m.Sum == nil || !m.Sum.IsMonotonic || m.Sum.AggregationTemporality != aggregationTemporalityDelta {
+			t.Fatalf("desc: %q, the first metric should be the delta monotonic sum of inbound bytes, not %+v", tc.desc, m)
+		}
+		if conns := metrics[len(metrics)-1]; conns.Name != "lsconntrack.flow.connections" || conns.Gauge == nil || conns.Gauge.DataPoints[0].AsInt != "1" {
+			t.Errorf("desc: %q, the last metric should be the gauge of 1 connection, not %+v", tc.desc, conns)
+		}
+		dp := m.Sum.DataPoints[0]
+		if !reflect.DeepEqual(dp.Attributes, tc.attributes) {
+			t.Errorf("desc: %q, attributes should be %v, not %v", tc.desc, tc.attributes, dp.Attributes)
+		}
+		if dp.AsInt != tc.inBytes || dp.StartTimeUnixNano != "1500000000000000000" || dp.TimeUnixNano != "1500000060000000000" {
+			t.Errorf("desc: %q, data point should be %s at 1500000060000000000 since 1500000000000000000, not %+v", tc.desc, tc.inBytes, dp)
+		}
+	}
+}
+
+func TestMetrics_first(t *testing.T) {
+	line := "tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=2 bytes=200 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=3 bytes=300 [ASSURED] mark=0 secmark=0 use=1"
+	flows := conntracktest.Web.Parse(t, line)
+	metrics := Metrics(flows, "app-1", "0.1.0", time.Time{}, time.Unix(1500000000, 0)).ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 1 || metrics[0].Gauge == nil {
+		t.Errorf("the first round should have only the gauge of the connections, not %+v", metrics)
+	}
+}
+
+func TestExporter_Export(t *testing.T) {
+	line := "tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=2 bytes=200 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=3 bytes=300 [ASSURED] mark=0 secmark=0 use=1"
+	flows := conntracktest.Web.Parse(t, line)
+	tests := []struct {
+		desc     string
+		path     string
+		status   int
+		expected string // the path received, or the error
+	}{
+		{desc: "default path", path: "", status: http.StatusOK, expected: "/v1/metrics"},
+		{desc: "unavailable", path: "/otlp/v1/metrics", status: http.StatusServiceUnavailable, expected: "503"},
+	}
+	for _, tc := range tests {
+		var received MetricsData
+		var path, contentType string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+			if tc.status != http.StatusOK {
+				http.Error(w, "unavailable", tc.status)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			if err := json.Unmarshal(body, &received); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{}"))
+		}))
+
+		e, err := NewExporter(ts.URL+tc.path, "0.1.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = e.Export(flows, "app-1", time.Now())
+		ts.Close()
+		if tc.status != http.StatusOK {
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("desc: %q, should raise the status error, not %v", tc.desc, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("desc: %q, should not raise error: %v", tc.desc, err)
+		}
+		if path != tc.expected {
+			t.Errorf("desc: %q, path should be %q, not %q", tc.desc, tc.expected, path)
+		}
+		if contentType != "application/json" {
+			t.Errorf("desc: %q, content type should be application/json, not %q", tc.desc, contentType)
+		}
+		if len(received.ResourceMetrics) != 1 {
+			t.Errorf("desc: %q, the collector should receive 1 resource, not %d", tc.desc, len(received.ResourceMetrics))
+		}
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	if _, err := NewExporter("localhost:4318", ""); err == nil {
+		t.Error("should raise error on the URL without http scheme")
+	}
+}
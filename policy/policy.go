@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+// Rule represents the host flows allowed by the policy.
+// The empty fields match any flows.
+type Rule struct {
+	Direction conntrack.FlowDirection `json:"direction,omitempty"`
+	// Peer are the IP address or CIDR of the peer, or the server on FlowForwarded.
+	Peer string `json:"peer,omitempty"`
+	// Port are the peer port on FlowActive and FlowForwarded, and the local port on FlowPassive.
+	Port    string `json:"port,omitempty"`
+	Comment string `json:"comment,omitempty"`
+
+	peer *net.IPNet
+}
+
+// String returns the string representation of the Rule.
+func (r *Rule) String() string {
+	if r.Comment != "" {
+		return r.Comment
+	}
+	dire, peer, port := "any", "any", "any"
+	if r.Direction != 0 {
+		dire = r.Direction.String()
+	}
+	if r.Peer != "" {
+		peer = r.Peer
+	}
+	if r.Port != "" {
+		port = r.Port
+	}
+	return fmt.Sprintf("%s %s:%s", dire, peer, port)
+}
+
+// Allows returns whether the rule allows the flow.
+func (r *Rule) Allows(flow *conntrack.HostFlow) bool {
+	if r.Direction != 0 && r.Direction != flow.Direction {
+		return false
+	}
+	if r.peer != nil {
+		ip := net.ParseIP(flow.Peer.Addr)
+		if ip == nil || !r.peer.Contains(ip) {
+			return false
+		}
+	}
+	if r.Port != "" {
+		port := flow.Peer.Port
+		if flow.Direction == conntrack.FlowPassive {
+			port = flow.Local.Port
+		}
+		if port != r.Port {
+			return false
+		}
+	}
+	return true
+}
+
+// Policy are the allowed host flows. The flows allowed by no rules are violations.
+type Policy struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// Load reads the policy as json format.
+func Load(r io.Reader) (*Policy, error) {
+	var p Policy
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to decode policy: %v", err)
+	}
+	for i, rule := range p.Rules {
+		if rule.Peer == "" {
+			continue
+		}
+		peer, err := parsePeer(rule.Peer)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		rule.peer = peer
+	}
+	return &p, nil
+}
+
+// parsePeer parses the IP address or CIDR.
+func parsePeer(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("%s is not IP address or CIDR", s)
+		}
+		if ip.To4() != nil {
+			s += "/32"
+		} else {
+			s += "/128"
+		}
+	}
+	_, ipnet, err := net.ParseCIDR(s)
+	return ipnet, err
+}
+
+// Result represents the evaluation of a host flow.
+// Rule are the first rule that allows the flow, or nil on violation.
+type Result struct {
+	Flow *conntrack.HostFlow `json:"flow"`
+	Rule *Rule               `json:"rule"`
+}
+
+// Allowed returns whether the flow is allowed.
+func (r *Result) Allowed() bool {
+	return r.Rule != nil
+}
+
+// Evaluate evaluates the flows against the policy, sorted by the unique key.
+func (p *Policy) Evaluate(flows conntrack.HostFlows) []*Result {
+	results := make([]*Result, 0, len(flows))
+	for _, flow := range flows {
+		result := &Result{Flow: flow}
+		for _, rule := range p.Rules {
+			if rule.Allows(flow) {
+				result.Rule = rule
+				break
+			}
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Flow.UniqKey() < results[j].Flow.UniqKey()
+	})
+	return results
+}
+
+// Violations returns the results of the flows allowed by no rules.
+func Violations(results []*Result) []*Result {
+	violations := []*Result{}
+	for _, r := range results {
+		if !r.Allowed() {
+			violations = append(violations, r)
+		}
+	}
+	return violations
+}
@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+var testPolicy = `{
+  "rules": [
+    {"direction": "active", "peer": "10.0.1.0/24", "port": "3306"},
+    {"direction": "passive", "peer": "10.0.100.0/24", "port": "80", "comment": "http from LB only"}
+  ]
+}`
+
+func TestPolicyEvaluate(t *testing.T) {
+	p, err := Load(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatalf("Load should not return error: %v", err)
+	}
+	flows := conntrack.HostFlows{
+		"active-db": {
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "3306"},
+		},
+		"active-redis": {
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "6379"},
+		},
+		"passive-lb": {
+			Direction: conntrack.FlowPassive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "80"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.100.5", Port: "many"},
+		},
+		"passive-other": {
+			Direction: conntrack.FlowPassive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "80"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.2.10", Port: "many"},
+		},
+	}
+	results := p.Evaluate(flows)
+	if len(results) != len(flows) {
+		t.Fatalf("results should be %d, not %d", len(flows), len(results))
+	}
+	violations := Violations(results)
+	expected := []string{"10.0.1.10:6379", "10.0.2.10:many"}
+	if len(violations) != len(expected) {
+		t.Fatalf("violations should be %d, not %d", len(expected), len(violations))
+	}
+	for i, v := range violations {
+		if v.Flow.Peer.String() != expected[i] {
+			t.Errorf("violation should be %q, not %q", expected[i], v.Flow.Peer)
+		}
+	}
+	for _, r := range results {
+		if r.Flow.Peer.Addr == "10.0.100.5" && r.Rule.String() != "http from LB only" {
+			t.Errorf("rule should be %q, not %q", "http from LB only", r.Rule)
+		}
+	}
+}
+
+func TestLoad_error(t *testing.T) {
+	tests := []struct {
+		desc   string
+		policy string
+	}{
+		{desc: "invalid peer", policy: `{"rules": [{"peer": "10.0.1"}]}`},
+		{desc: "invalid direction", policy: `{"rules": [{"direction": "inbound"}]}`},
+		{desc: "not json", policy: `rules:`},
+	}
+	for _, tc := range tests {
+		if _, err := Load(strings.NewReader(tc.policy)); err == nil {
+			t.Errorf("desc: %q, Load should return error", tc.desc)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// pushTimeout are the timeout to connect to the push target.
+const pushTimeout = 5 * time.Second
+
+// openPush opens the target to push the metrics to, which are 'unix:///path/to/socket',
+// 'tcp://host:port', 'udp://host:port' or the file appended to.
+func openPush(target string) (io.WriteCloser, error) {
+	for _, network := range []string{"unix", "tcp", "udp"} {
+		if strings.HasPrefix(target, network+"://") {
+			return net.DialTimeout(network, strings.TrimPrefix(target, network+"://"), pushTimeout)
+		}
+	}
+	return os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
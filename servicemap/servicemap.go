@@ -0,0 +1,138 @@
+package servicemap
+
+import (
+	"encoding/csv"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+// Host are the host flows observed on a host.
+type Host struct {
+	Name string
+	// Addrs are the addresses and names of the host other than Name,
+	// which the peers of the other hosts are matched against.
+	Addrs []string
+	Flows conntrack.HostFlows
+}
+
+// edge are the connections from the client to the server port.
+type edge struct {
+	client, server, port string
+}
+
+// Merge joins the host flows of the hosts into the cluster flows from the client to the server.
+// The active flow of a host to the port of another host is paired with the passive flow
+// of the other host on the port, and the traffic of the pair is counted once by the active side.
+// The flows to or from the hosts that are not given are kept with the peer address.
+// The returned flows are active from the client (Local) to the server (Peer) except the forwarded flows.
+func Merge(hosts []*Host) conntrack.HostFlows {
+	names := map[string]string{}
+	for _, h := range hosts {
+		for _, addr := range append([]string{h.Name}, h.Addrs...) {
+			names[addr] = h.Name
+			// the peers resolved into the short hostname.
+			if i := strings.Index(addr, "."); i > 0 && net.ParseIP(addr) == nil {
+				if _, ok := names[addr[:i]]; !ok {
+					names[addr[:i]] = h.Name
+				}
+			}
+		}
+	}
+	nameOf := func(addr string) string {
+		if name, ok := names[addr]; ok {
+			return name
+		}
+		return addr
+	}
+
+	actives := map[edge]*conntrack.HostFlowStat{}
+	passives := map[edge]*conntrack.HostFlowStat{}
+	forwarded := conntrack.HostFlows{}
+	for _, h := range hosts {
+		for _, flow := range h.Flows {
+			switch flow.Direction {
+			case conntrack.FlowActive:
+				add(actives, edge{h.Name, nameOf(flow.Peer.Addr), flow.Peer.Port}, flow.Stat)
+			case conntrack.FlowPassive:
+				// turn the stat into the view from the client.
+				add(passives, edge{nameOf(flow.Peer.Addr), h.Name, flow.Local.Port}, &conntrack.HostFlowStat{
+					TotalInboundPackets:  flow.Stat.TotalOutboundPackets,
+					TotalInboundBytes:    flow.Stat.TotalOutboundBytes,
+					TotalOutboundPackets: flow.Stat.TotalInboundPackets,
+					TotalOutboundBytes:   flow.Stat.TotalInboundBytes,
+					TotalConnections:     flow.Stat.TotalConnections,
+				})
+			case conntrack.FlowForwarded:
+				f := *flow
+				f.Netns, f.Host = "", h.Name
+				forwarded[h.Name+"-"+f.UniqKey()] = &f
+			}
+		}
+	}
+	for e, stat := range passives {
+		if _, ok := actives[e]; !ok {
+			actives[e] = stat
+		}
+	}
+
+	flows := conntrack.HostFlows{}
+	for e, stat := range actives {
+		flow := &conntrack.HostFlow{
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: e.client, Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: e.server, Port: e.port},
+			Stat:      stat,
+		}
+		flows[flow.UniqKey()] = flow
+	}
+	for key, flow := range forwarded {
+		flows[key] = flow
+	}
+	return flows
+}
+
+func add(edges map[edge]*conntrack.HostFlowStat, e edge, stat *conntrack.HostFlowStat) {
+	sum, ok := edges[e]
+	if !ok {
+		sum = &conntrack.HostFlowStat{}
+		edges[e] = sum
+	}
+	sum.TotalInboundPackets += stat.TotalInboundPackets
+	sum.TotalInboundBytes += stat.TotalInboundBytes
+	sum.TotalOutboundPackets += stat.TotalOutboundPackets
+	sum.TotalOutboundBytes += stat.TotalOutboundBytes
+	sum.TotalConnections += stat.TotalConnections
+}
+
+// WriteCSV writes the merged flows as the adjacency list in CSV format:
+// client,server,port,direction,bytes,packets,connections
+func WriteCSV(w io.Writer, flows conntrack.HostFlows) error {
+	list := make([]*conntrack.HostFlow, 0, len(flows))
+	for _, flow := range flows {
+		list = append(list, flow)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].UniqKey() < list[j].UniqKey()
+	})
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"client", "server", "port", "direction", "bytes", "packets", "connections"})
+	for _, flow := range list {
+		s := flow.Stat
+		cw.Write([]string{
+			flow.Local.Addr,
+			flow.Peer.Addr,
+			flow.Peer.Port,
+			flow.Direction.String(),
+			strconv.FormatInt(s.TotalInboundBytes+s.TotalOutboundBytes, 10),
+			strconv.FormatInt(s.TotalInboundPackets+s.TotalOutboundPackets, 10),
+			strconv.FormatInt(s.TotalConnections, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
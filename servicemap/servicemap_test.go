@@ -0,0 +1,86 @@
+package servicemap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+func TestMerge(t *testing.T) {
+	web := &Host{
+		Name:  "web01",
+		Addrs: []string{"10.0.0.10"},
+		Flows: conntrack.HostFlows{
+			"db": {
+				Direction: conntrack.FlowActive,
+				Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+				Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "3306"},
+				Stat:      &conntrack.HostFlowStat{TotalInboundBytes: 1000, TotalOutboundBytes: 100, TotalConnections: 2},
+			},
+			"lb": {
+				Direction: conntrack.FlowPassive,
+				Local:     &conntrack.AddrPort{Addr: "localhost", Port: "80"},
+				Peer:      &conntrack.AddrPort{Addr: "10.0.100.1", Port: "many"},
+				Stat:      &conntrack.HostFlowStat{TotalInboundBytes: 50, TotalOutboundBytes: 500, TotalConnections: 5},
+			},
+		},
+	}
+	db := &Host{
+		Name:  "db01.example.com",
+		Addrs: []string{"10.0.1.10"},
+		Flows: conntrack.HostFlows{
+			"web": {
+				Direction: conntrack.FlowPassive,
+				Local:     &conntrack.AddrPort{Addr: "localhost", Port: "3306"},
+				Peer:      &conntrack.AddrPort{Addr: "10.0.0.10", Port: "many"},
+				Stat:      &conntrack.HostFlowStat{TotalInboundBytes: 100, TotalOutboundBytes: 1000, TotalConnections: 2},
+			},
+			"batch": {
+				Direction: conntrack.FlowPassive,
+				Local:     &conntrack.AddrPort{Addr: "localhost", Port: "3306"},
+				Peer:      &conntrack.AddrPort{Addr: "10.0.2.10", Port: "many"},
+				Stat:      &conntrack.HostFlowStat{TotalInboundBytes: 10, TotalOutboundBytes: 20, TotalConnections: 1},
+			},
+		},
+	}
+
+	flows := Merge([]*Host{web, db})
+	expected := map[string]conntrack.HostFlowStat{
+		"2-web01:many-db01.example.com:3306":     {TotalInboundBytes: 1000, TotalOutboundBytes: 100, TotalConnections: 2},
+		"2-10.0.100.1:many-web01:80":             {TotalInboundBytes: 500, TotalOutboundBytes: 50, TotalConnections: 5},
+		"2-10.0.2.10:many-db01.example.com:3306": {TotalInboundBytes: 20, TotalOutboundBytes: 10, TotalConnections: 1},
+	}
+	if len(flows) != len(expected) {
+		t.Fatalf("flows should be %d, not %d: %v", len(expected), len(flows), flows)
+	}
+	for key, stat := range expected {
+		flow, ok := flows[key]
+		if !ok {
+			t.Errorf("%q should be merged", key)
+			continue
+		}
+		if *flow.Stat != stat {
+			t.Errorf("%q stat should be %v, not %v", key, stat, *flow.Stat)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	flows := conntrack.HostFlows{
+		"web": {
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "web01", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: "db01", Port: "3306"},
+			Stat:      &conntrack.HostFlowStat{TotalInboundBytes: 1000, TotalInboundPackets: 3, TotalConnections: 2},
+		},
+	}
+	var b bytes.Buffer
+	if err := WriteCSV(&b, flows); err != nil {
+		t.Fatalf("WriteCSV should not return error: %v", err)
+	}
+	expected := "client,server,port,direction,bytes,packets,connections\nweb01,db01,3306,active,1000,3,2\n"
+	if b.String() != expected {
+		t.Errorf("output should be %q, not %q", expected, b.String())
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/ipfix"
+	"github.com/yuuki/lsconntrack/otlp"
+	"github.com/yuuki/lsconntrack/statsd"
+)
+
+// sinks are the agent and the collectors to which the host flows are sent instead of printed in watch mode.
+type sinks struct {
+	sd       *statsd.Client
+	statsdTo string
+	ex       *ipfix.Exporter
+	exportTo string
+	ot       *otlp.Exporter
+	otlpTo   string
+}
+
+// enabled returns whether any sink is given.
+func (s *sinks) enabled() bool {
+	return s.sd != nil || s.ex != nil || s.ot != nil
+}
+
+// send sends the host flows of the tick to each sink. The failures are logged, and the agent
+// or the collector unavailable for a while does not stop watching. The addresses are replaced into
+// the names by resolve on the copies of the flows, so that the IPFIX records keep the numerical addresses.
+func (s *sinks) send(t *tick, flows conntrack.HostFlows, resolve func(string) string, direction conntrack.FlowDirection, o *origin) {
+	if s.ex != nil {
+		if err := s.ex.Export(flows.Filter(direction), o.addrs, t.at); err != nil {
+			log.Printf("failed to export to %v: %v\n", s.exportTo, err)
+		}
+	}
+	if s.ot != nil {
+		if err := exportHostFlowsToOTLP(s.ot, flows, resolve, direction, o.host, t.at); err != nil {
+			log.Printf("failed to export to %v: %v\n", s.otlpTo, err)
+		}
+	}
+	if s.sd != nil {
+		if err := sendHostFlowsToStatsD(s.sd, flows, resolve, direction, o.host); err != nil {
+			log.Printf("failed to send to %v: %v\n", s.statsdTo, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package snapshot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/netutil"
+)
+
+// Version are the format version of the snapshot.
+const Version = 1
+
+// Snapshot represents the conntrack table with the host state needed to analyse it later on another host.
+type Snapshot struct {
+	Version            int                `json:"version"`
+	Hostname           string             `json:"hostname"`
+	Kernel             string             `json:"kernel"`
+	Timestamp          time.Time          `json:"timestamp"`
+	LocalAddrs         []string           `json:"local_addrs"`
+	ListeningPorts     []string           `json:"listening_ports"`
+	EphemeralPortRange *netutil.PortRange `json:"ephemeral_port_range,omitempty"`
+	// Conntrack are the raw conntrack table.
+	Conntrack string `json:"conntrack"`
+}
+
+// Take takes the snapshot of this host.
+func Take() (*Snapshot, error) {
+	path := netutil.FindConntrackPath()
+	if path == "" {
+		return nil, fmt.Errorf("not found conntrack entries path: Please load conntrack module")
+	}
+	table, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %v: %v", path, err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	kernel, err := netutil.KernelRelease()
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := netutil.LocalIPAddrs()
+	if err != nil {
+		return nil, err
+	}
+	ports, err := netutil.LocalListeningPorts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local listening ports: %v", err)
+	}
+	// the range are optional since it is only a hint for the direction.
+	ephemeral, _ := netutil.EphemeralPortRange()
+	return &Snapshot{
+		Version:            Version,
+		Hostname:           hostname,
+		Kernel:             kernel,
+		Timestamp:          time.Now().UTC(),
+		LocalAddrs:         addrs,
+		ListeningPorts:     ports,
+		EphemeralPortRange: ephemeral,
+		Conntrack:          string(table),
+	}, nil
+}
+
+// Write writes the snapshot as gzipped JSON.
+func (s *Snapshot) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(s); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Read reads the snapshot from gzipped or plain JSON.
+func Read(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	var jr io.Reader = br
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		jr = zr
+	}
+	var s Snapshot
+	if err := json.NewDecoder(jr).Decode(&s); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %v", err)
+	}
+	if s.Version < 1 || s.Version > Version {
+		return nil, fmt.Errorf("unsupported snapshot version: %d", s.Version)
+	}
+	return &s, nil
+}
+
+// ReadFile reads the snapshot file.
+func ReadFile(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Capture returns the conntrack entries bundled with the local addresses and the listening ports.
+func (s *Snapshot) Capture() *conntrack.Capture {
+	return &conntrack.Capture{
+		LocalAddrs:     s.LocalAddrs,
+		ListeningPorts: s.ListeningPorts,
+		Entries:        []byte(s.Conntrack),
+	}
+}
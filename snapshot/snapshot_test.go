@@ -0,0 +1,46 @@
+package snapshot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuuki/lsconntrack/netutil"
+)
+
+func TestWriteRead(t *testing.T) {
+	s := &Snapshot{
+		Version:            Version,
+		Hostname:           "web01",
+		Kernel:             "4.9.0-6-amd64",
+		Timestamp:          time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+		LocalAddrs:         []string{"10.0.0.10"},
+		ListeningPorts:     []string{"80"},
+		EphemeralPortRange: &netutil.PortRange{Min: 32768, Max: 60999},
+		Conntrack:          "tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80 packets=3 bytes=164 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=41143 packets=1 bytes=60 [ASSURED] mark=0 secmark=0 use=1\n",
+	}
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if got.Hostname != s.Hostname || !got.Timestamp.Equal(s.Timestamp) || got.Conntrack != s.Conntrack || *got.EphemeralPortRange != *s.EphemeralPortRange {
+		t.Errorf("snapshot should be %v, not %v", s, got)
+	}
+	if c := got.Capture(); string(c.Entries) != s.Conntrack || c.LocalAddrs[0] != "10.0.0.10" {
+		t.Errorf("unexpected capture: %v", c)
+	}
+}
+
+func TestRead_plainAndVersion(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"version": 1, "hostname": "web01"}`)); err != nil {
+		t.Errorf("should read plain JSON: %v", err)
+	}
+	if _, err := Read(strings.NewReader(`{"version": 99}`)); err == nil {
+		t.Error("should raise error on unsupported version")
+	}
+}
@@ -0,0 +1,92 @@
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/metrics"
+)
+
+// maxPacketSize are the size of a datagram not to be fragmented on the ethernet.
+const maxPacketSize = 1432
+
+// Client sends the deltas of the host flows between the rounds to StatsD over UDP
+// with the DogStatsD tags.
+type Client struct {
+	conn   net.Conn
+	deltas conntrack.DeltaTracker
+}
+
+// Dial returns the client to send to the StatsD server at addr such as 'localhost:8125'.
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Send sends the bytes and packets since the previous round as the counters,
+// and the connections as the gauges. The first round only sends the gauges.
+func (c *Client) Send(flows conntrack.HostFlows, host string) error {
+	deltas, since := c.deltas.Deltas(flows, time.Now())
+	return c.write(lines(metrics.Points(deltas, host, time.Time{}), since.IsZero()))
+}
+
+var tagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", " ", "_")
+
+// lines returns the metric lines of the points such as
+// 'lsconntrack.in_bytes:1024|c|#direction:active,peer:10.0.1.10,port:3306,proto:tcp'.
+// The connections are the gauges and the others are the counters, which are omitted if gaugesOnly.
+func lines(points []*metrics.Point, gaugesOnly bool) []string {
+	var ls []string
+	for _, p := range points {
+		var tags []string
+		for _, k := range p.TagKeys() {
+			tags = append(tags, k+":"+tagEscaper.Replace(p.Tags[k]))
+		}
+		for _, f := range p.Fields {
+			typ := "c"
+			if f.Name == "connections" {
+				typ = "g"
+			} else if gaugesOnly {
+				continue
+			}
+			ls = append(ls, fmt.Sprintf("%s.%s:%d|%s|#%s", metrics.Measurement, f.Name, f.Value, typ, strings.Join(tags, ",")))
+		}
+	}
+	return ls
+}
+
+// write sends the lines packed into the datagrams of maxPacketSize at most.
+func (c *Client) write(lines []string) error {
+	var buf []byte
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+		_, err := c.conn.Write(buf)
+		buf = buf[:0]
+		return err
+	}
+	for _, l := range lines {
+		if len(buf) > 0 && len(buf)+1+len(l) > maxPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if len(buf) > 0 {
+			buf = append(buf, '\n')
+		}
+		buf = append(buf, l...)
+	}
+	return flush()
+}
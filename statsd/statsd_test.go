@@ -0,0 +1,100 @@
+package statsd
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+func TestClient_Send(t *testing.T) {
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c, err := Dial(ln.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	flows := func(inBytes, outBytes int64) conntrack.HostFlows {
+		flow := &conntrack.HostFlow{
+			Direction: conntrack.FlowActive,
+			Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+			Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "3306"},
+			Stat:      &conntrack.HostFlowStat{TotalInboundPackets: 10, TotalInboundBytes: inBytes, TotalOutboundPackets: 5, TotalOutboundBytes: outBytes, TotalConnections: 2},
+		}
+		return conntrack.HostFlows{flow.UniqKey(): flow}
+	}
+	tags := "|#direction:active,peer:10.0.1.10,port:3306,proto:tcp"
+	tests := []struct {
+		desc     string
+		flows    conntrack.HostFlows
+		expected []string
+	}{
+		{
+			desc:     "first round",
+			flows:    flows(1000, 500),
+			expected: []string{"lsconntrack.connections:2|g" + tags},
+		},
+		{
+			desc:  "second round",
+			flows: flows(1500, 400),
+			expected: []string{
+				"lsconntrack.in_bytes:500|c" + tags,
+				"lsconntrack.out_bytes:0|c" + tags,
+				"lsconntrack.in_packets:0|c" + tags,
+				"lsconntrack.out_packets:0|c" + tags,
+				"lsconntrack.connections:2|g" + tags,
+			},
+		},
+	}
+	buf := make([]byte, maxPacketSize)
+	for _, tc := range tests {
+		if err := c.Send(tc.flows, ""); err != nil {
+			t.Fatalf("desc: %q, should not raise error: %v", tc.desc, err)
+		}
+		ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := ln.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("desc: %q, should receive the datagram: %v", tc.desc, err)
+		}
+		if got := strings.Split(string(buf[:n]), "\n"); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("desc: %q, datagram should be %q, not %q", tc.desc, tc.expected, got)
+		}
+	}
+}
+
+func TestClient_write(t *testing.T) {
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c, err := Dial(ln.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	line := strings.Repeat("x", 1000)
+	if err := c.write([]string{line, line, line}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 65536)
+	for i := 0; i < 3; i++ {
+		ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := ln.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("datagram %d should be received: %v", i+1, err)
+		}
+		if n != len(line) {
+			t.Errorf("datagram %d should be %d bytes, not %d", i+1, len(line), n)
+		}
+	}
+}
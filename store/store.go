@@ -0,0 +1,263 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+// Record are the host flows collected at a time.
+type Record struct {
+	At    time.Time           `json:"at"`
+	Host  string              `json:"host,omitempty"`
+	Flows conntrack.HostFlows `json:"flows"`
+}
+
+// recordsBucket are the bucket of the records, whose keys are the time and the host
+// so that the records are iterated in order of time from any time.
+var recordsBucket = []byte("records")
+
+// seenBucket are the bucket of the flows last recorded with when they are seen, by the unique key.
+// They are apart from the records so that the compaction does not remove nor downsample them.
+var seenBucket = []byte("seen")
+
+// lockTimeout are how long to wait for the file locked by the other process.
+const lockTimeout = 10 * time.Second
+
+// DB are the records stored in a BoltDB file. The file are opened for each operation
+// and closed soon, so that a recorder appends to it while the readers query it.
+type DB struct {
+	path string
+}
+
+// Open returns the db of the file at path, which is created on the first append.
+func Open(path string) *DB {
+	return &DB{path: path}
+}
+
+// recordKey returns the key of the record, which are the time in nanoseconds in big endian followed by the host.
+func recordKey(at time.Time, host string) []byte {
+	key := make([]byte, 8, 8+len(host))
+	binary.BigEndian.PutUint64(key, uint64(at.UnixNano()))
+	return append(key, host...)
+}
+
+// update opens the file to write, creating it if not exist, and runs fn in a read-write transaction
+// with the buckets of the records and the seen flows.
+func (db *DB) update(fn func(records, seen *bolt.Bucket) error) error {
+	bdb, err := bolt.Open(db.path, 0644, &bolt.Options{Timeout: lockTimeout})
+	if err != nil {
+		return err
+	}
+	defer bdb.Close()
+	return bdb.Update(func(tx *bolt.Tx) error {
+		records, err := tx.CreateBucketIfNotExists(recordsBucket)
+		if err != nil {
+			return err
+		}
+		seen, err := tx.CreateBucketIfNotExists(seenBucket)
+		if err != nil {
+			return err
+		}
+		return fn(records, seen)
+	})
+}
+
+// view opens the file to read and runs fn in a read-only transaction with the bucket of the name,
+// unless the bucket has not been created yet. It returns the error of os.IsNotExist if the file has not been created yet.
+func (db *DB) view(name []byte, fn func(b *bolt.Bucket) error) error {
+	// bolt creates the file missing even in read-only mode.
+	if _, err := os.Stat(db.path); err != nil {
+		return err
+	}
+	bdb, err := bolt.Open(db.path, 0644, &bolt.Options{Timeout: lockTimeout, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer bdb.Close()
+	return bdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(name)
+		if b == nil {
+			return nil
+		}
+		return fn(b)
+	})
+}
+
+// Append appends the record to the file. The flows are recorded without Seen, and those
+// that have Seen are stored by the unique key in place of the previous ones, to be returned by Seen.
+func (db *DB) Append(r *Record) error {
+	flows := make(conntrack.HostFlows, len(r.Flows))
+	seen := map[string][]byte{}
+	for key, flow := range r.Flows {
+		if flow.Seen != nil {
+			v, err := json.Marshal(flow)
+			if err != nil {
+				return err
+			}
+			seen[key] = v
+		}
+		c := *flow
+		c.Seen = nil
+		flows[key] = &c
+	}
+	v, err := json.Marshal(&Record{At: r.At, Host: r.Host, Flows: flows})
+	if err != nil {
+		return err
+	}
+	return db.update(func(records, sb *bolt.Bucket) error {
+		for key, v := range seen {
+			if err := sb.Put([]byte(key), v); err != nil {
+				return err
+			}
+		}
+		return records.Put(recordKey(r.At, r.Host), v)
+	})
+}
+
+// Seen returns the flows last recorded with Seen by the unique key, regardless of the retention of the records.
+func (db *DB) Seen() (conntrack.HostFlows, error) {
+	flows := conntrack.HostFlows{}
+	err := db.view(seenBucket, func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			var flow conntrack.HostFlow
+			if err := json.Unmarshal(v, &flow); err != nil {
+				return err
+			}
+			flows[string(k)] = &flow
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return flows, nil
+}
+
+// Records returns the records at or after since in order of time.
+// Only the records since then are read.
+func (db *DB) Records(since time.Time) ([]*Record, error) {
+	var records []*Record
+	err := db.view(recordsBucket, func(b *bolt.Bucket) error {
+		var err error
+		records, err = scan(b.Cursor(), since, time.Time{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// scan returns the records at or after since and before until, or to the last if until is zero.
+func scan(c *bolt.Cursor, since, until time.Time) ([]*Record, error) {
+	k, v := c.First()
+	if !since.IsZero() {
+		k, v = c.Seek(recordKey(since, ""))
+	}
+	var records []*Record
+	for ; k != nil; k, v = c.Next() {
+		if !until.IsZero() && bytes.Compare(k, recordKey(until, "")) >= 0 {
+			break
+		}
+		var r Record
+		if err := json.Unmarshal(v, &r); err != nil {
+			return nil, err
+		}
+		records = append(records, &r)
+	}
+	return records, nil
+}
+
+// Policy are the retention and the downsampling of the records.
+type Policy struct {
+	// Retention are how long the records are kept. They are kept forever if 0.
+	Retention time.Duration
+	// Resolution are the interval of the records older than DownsampleAfter.
+	// The records are not downsampled if 0.
+	Resolution      time.Duration
+	DownsampleAfter time.Duration
+}
+
+// Compact removes the records older than the retention and downsamples the old records at now.
+// Only the records to be removed or downsampled are read.
+func (db *DB) Compact(now time.Time, p Policy) error {
+	if _, err := os.Stat(db.path); os.IsNotExist(err) {
+		return nil
+	}
+	return db.update(func(b, _ *bolt.Bucket) error {
+		var expired time.Time
+		if p.Retention > 0 {
+			expired = now.Add(-p.Retention)
+			c := b.Cursor()
+			end := recordKey(expired, "")
+			for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.First() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		if p.Resolution <= 0 {
+			return nil
+		}
+		until := now.Add(-p.DownsampleAfter)
+		// the interval of the resolution containing until are downsampled by the later compaction once it ends.
+		records, err := scan(b.Cursor(), expired, until.Truncate(p.Resolution))
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := b.Delete(recordKey(r.At, r.Host)); err != nil {
+				return err
+			}
+		}
+		for _, r := range Downsample(records, until, p.Resolution) {
+			v, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(recordKey(r.At, r.Host), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Downsample merges the records of each host before until into a record per resolution.
+// The merged record are at the last record of the interval, and have all the flows of the interval,
+// each of which has the stat of the last record that it appears in.
+func Downsample(records []*Record, until time.Time, resolution time.Duration) []*Record {
+	type bucket struct {
+		host  string
+		start time.Time
+	}
+	var result []*Record
+	merged := map[bucket]*Record{}
+	for _, r := range records {
+		if !r.At.Before(until) {
+			result = append(result, r)
+			continue
+		}
+		b := bucket{r.Host, r.At.Truncate(resolution)}
+		m, ok := merged[b]
+		if !ok {
+			m = &Record{Host: r.Host, Flows: conntrack.HostFlows{}}
+			merged[b] = m
+			result = append(result, m)
+		}
+		m.At = r.At
+		for key, flow := range r.Flows {
+			m.Flows[key] = flow
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].At.Before(result[j].At) })
+	return result
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/conntrack/conntracktest"
+)
+
+func testDB(t *testing.T) (*DB, func()) {
+	dir, err := ioutil.TempDir("", "lsconntrack-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Open(filepath.Join(dir, "flows.db")), func() { os.RemoveAll(dir) }
+}
+
+func TestDB_Records(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	if _, err := db.Records(time.Time{}); !os.IsNotExist(err) {
+		t.Errorf("should raise the error of the file not created yet, not %v", err)
+	}
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	// the records appended out of order are read in order of time.
+	for _, i := range []int{2, 0, 1} {
+		line := fmt.Sprintf("tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=1 bytes=60 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=%d [ASSURED] mark=0 secmark=0 use=1", i)
+		flows := conntracktest.Web.Parse(t, line)
+		if err := db.Append(&Record{At: now.Add(time.Duration(i) * time.Minute), Host: "app-1", Flows: flows}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		desc     string
+		since    time.Time
+		expected []int64
+	}{
+		{"all", time.Time{}, []int64{0, 1, 2}},
+		{"since", now.Add(time.Minute), []int64{1, 2}},
+		{"since the last", now.Add(2*time.Minute + time.Second), nil},
+	}
+	for _, tc := range tests {
+		records, err := db.Records(tc.since)
+		if err != nil {
+			t.Fatalf("desc: %q, should not raise error: %v", tc.desc, err)
+		}
+		var got []int64
+		for _, r := range records {
+			got = append(got, r.Flows.List()[0].Stat.TotalInboundBytes)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+			t.Errorf("desc: %q, the records should be of the bytes %v, not %v", tc.desc, tc.expected, got)
+		}
+	}
+}
+
+func TestDB_Compact(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	now := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	for _, r := range []struct {
+		at    time.Time
+		peer  string
+		bytes int
+	}{
+		{now.Add(-10 * 24 * time.Hour), "10.0.1.10", 100}, // expired
+		{now.Add(-48*time.Hour + 10*time.Minute), "10.0.1.10", 200},
+		{now.Add(-48*time.Hour + 20*time.Minute), "10.0.1.11", 300},
+		{now.Add(-48*time.Hour + 30*time.Minute), "10.0.1.10", 400},
+		{now.Add(-time.Hour), "10.0.1.10", 500},
+		{now.Add(-time.Hour + time.Minute), "10.0.1.10", 600},
+	} {
+		line := fmt.Sprintf("tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=%s sport=41143 dport=3306 packets=1 bytes=60 src=%s dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=%d [ASSURED] mark=0 secmark=0 use=1", r.peer, r.peer, r.bytes)
+		flows := conntracktest.Web.Parse(t, line)
+		if err := db.Append(&Record{At: r.at, Flows: flows}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := Policy{Retention: 7 * 24 * time.Hour, Resolution: time.Hour, DownsampleAfter: 24 * time.Hour}
+	if err := db.Compact(now, p); err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	records, err := db.Records(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("the number of the records should be 3, not %d", len(records))
+	}
+	downsampled := records[0]
+	if !downsampled.At.Equal(now.Add(-48*time.Hour + 30*time.Minute)) {
+		t.Errorf("the downsampled record should be at the last record, not %v", downsampled.At)
+	}
+	if len(downsampled.Flows) != 2 {
+		t.Errorf("the downsampled record should have 2 flows, not %d", len(downsampled.Flows))
+	}
+	for _, flow := range downsampled.Flows {
+		if flow.Peer.Addr == "10.0.1.10" && flow.Stat.TotalInboundBytes != 400 {
+			t.Errorf("the flow should have the last stat 400, not %d", flow.Stat.TotalInboundBytes)
+		}
+	}
+}
+
+func TestDB_Compact_notExist(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	if err := db.Compact(time.Now(), Policy{Retention: time.Hour}); err != nil {
+		t.Errorf("should not raise error on the file not created yet: %v", err)
+	}
+}
+
+func TestDB_Seen(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	line := "tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=1 bytes=60 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=100 [ASSURED] mark=0 secmark=0 use=1"
+	now := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	tracker := conntrack.NewTracker()
+	for _, at := range []time.Time{now.Add(-10 * 24 * time.Hour), now.Add(-time.Hour)} {
+		flows := conntracktest.Web.Parse(t, line)
+		tracker.Observe(flows, at)
+		if err := db.Append(&Record{At: at, Flows: flows}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Compact(now, Policy{Retention: 7 * 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := db.Records(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Flows.List()[0].Seen != nil {
+		t.Errorf("the record should be only the last one without seen, not %v", records)
+	}
+	flows, err := db.Seen()
+	if err != nil {
+		t.Fatalf("should not raise error: %v", err)
+	}
+	if len(flows) != 1 {
+		t.Fatalf("the seen flows should be 1, not %d", len(flows))
+	}
+	for _, flow := range flows {
+		if !flow.Seen.FirstSeen.Equal(now.Add(-10*24*time.Hour)) || !flow.Seen.LastSeen.Equal(now.Add(-time.Hour)) {
+			t.Errorf("the flow should be seen from the removed record to the last one, not %v - %v", flow.Seen.FirstSeen, flow.Seen.LastSeen)
+		}
+	}
+}
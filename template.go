@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/yuuki/lsconntrack/humanize"
+)
+
+// templateFuncs are the helper functions available in --template.
+var templateFuncs = template.FuncMap{
+	// {{.Stat.TotalOutboundBytes | humanize}}
+	"humanize": humanize.Bytes,
+	// {{if .Peer.Addr | inCIDR "10.0.0.0/8"}}internal{{end}}
+	"inCIDR": func(cidr, addr string) (bool, error) {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return false, err
+		}
+		ip := net.ParseIP(addr)
+		return ip != nil && ipnet.Contains(ip), nil
+	},
+	// {{.Peer.Addr | pad 16}} pads on the right and {{.Peer.Port | lpad 6}} on the left.
+	"pad": func(width int, v interface{}) string {
+		s := fmt.Sprint(v)
+		return s + strings.Repeat(" ", padding(width, s))
+	},
+	"lpad": func(width int, v interface{}) string {
+		s := fmt.Sprint(v)
+		return strings.Repeat(" ", padding(width, s)) + s
+	},
+}
+
+func padding(width int, s string) int {
+	if n := width - utf8.RuneCountInString(s); n > 0 {
+		return n
+	}
+	return 0
+}
+
+// parseTemplate parses the template applied to each HostFlow.
+// The newline are appended unless the template ends with it.
+func parseTemplate(text string) (*template.Template, error) {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return template.New("lsconntrack").Funcs(templateFuncs).Parse(text)
+}
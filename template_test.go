@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+func TestParseTemplate(t *testing.T) {
+	flow := &conntrack.HostFlow{
+		Direction: conntrack.FlowActive,
+		Local:     &conntrack.AddrPort{Addr: "localhost", Port: "many"},
+		Peer:      &conntrack.AddrPort{Addr: "10.0.1.10", Port: "3306"},
+		Stat:      &conntrack.HostFlowStat{TotalOutboundBytes: 1480239},
+	}
+	tests := []struct {
+		desc     string
+		text     string
+		expected string
+	}{
+		{
+			desc:     "fields",
+			text:     "{{.Peer.Addr}}:{{.Peer.Port}} {{.Stat.TotalOutboundBytes | humanize}}",
+			expected: "10.0.1.10:3306 1.4 MiB\n",
+		},
+		{
+			desc:     "cidr",
+			text:     "{{if .Peer.Addr | inCIDR \"10.0.0.0/16\"}}internal{{else}}external{{end}}\n",
+			expected: "internal\n",
+		},
+		{
+			desc:     "padding",
+			text:     "{{.Peer.Addr | pad 12}}|{{.Peer.Port | lpad 6}}|{{.Direction | pad 3}}|",
+			expected: "10.0.1.10   |  3306|active|\n",
+		},
+	}
+	for _, tc := range tests {
+		tmpl, err := parseTemplate(tc.text)
+		if err != nil {
+			t.Fatalf("desc: %q, parseTemplate should not return error: %v", tc.desc, err)
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, flow); err != nil {
+			t.Fatalf("desc: %q, Execute should not return error: %v", tc.desc, err)
+		}
+		if b.String() != tc.expected {
+			t.Errorf("desc: %q, output should be %q, not %q", tc.desc, tc.expected, b.String())
+		}
+	}
+
+	if _, err := parseTemplate("{{.Peer.Addr"); err == nil {
+		t.Error("parseTemplate should return error for the unclosed action")
+	}
+}
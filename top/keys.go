@@ -0,0 +1,50 @@
+package top
+
+// The keys other than the printable characters.
+const (
+	KeyUp        = "up"
+	KeyDown      = "down"
+	KeyRight     = "right"
+	KeyLeft      = "left"
+	KeyEnter     = "enter"
+	KeyEsc       = "esc"
+	KeyBackspace = "backspace"
+	KeyCtrlC     = "ctrl-c"
+)
+
+// ParseKeys parses the input of the terminal in raw mode into the keys.
+// The printable characters are the keys as they are, and the unknown escape sequences are skipped.
+func ParseKeys(b []byte) []string {
+	var keys []string
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; {
+		case c == 0x1b:
+			if i+2 < len(b) && (b[i+1] == '[' || b[i+1] == 'O') {
+				switch b[i+2] {
+				case 'A':
+					keys = append(keys, KeyUp)
+				case 'B':
+					keys = append(keys, KeyDown)
+				case 'C':
+					keys = append(keys, KeyRight)
+				case 'D':
+					keys = append(keys, KeyLeft)
+				}
+				// skip the parameters of the sequence such as '\x1b[5~'.
+				for i += 2; i < len(b) && (b[i] < 0x40 || b[i] > 0x7e); i++ {
+				}
+				continue
+			}
+			keys = append(keys, KeyEsc)
+		case c == '\r' || c == '\n':
+			keys = append(keys, KeyEnter)
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, KeyBackspace)
+		case c == 0x03:
+			keys = append(keys, KeyCtrlC)
+		case c >= 0x20 && c < 0x7f:
+			keys = append(keys, string(c))
+		}
+	}
+	return keys
+}
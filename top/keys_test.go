@@ -0,0 +1,25 @@
+package top
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected []string
+	}{
+		{"characters", "q1/", []string{"q", "1", "/"}},
+		{"arrows", "\x1b[A\x1b[B\x1bOC", []string{KeyUp, KeyDown, KeyRight}},
+		{"unknown sequence", "\x1b[5~j", []string{"j"}},
+		{"esc", "\x1b", []string{KeyEsc}},
+		{"controls", "\r\x7f\x03", []string{KeyEnter, KeyBackspace, KeyCtrlC}},
+	}
+	for _, tc := range tests {
+		if got := ParseKeys([]byte(tc.input)); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("desc: %q, keys should be %q, not %q", tc.desc, tc.expected, got)
+		}
+	}
+}
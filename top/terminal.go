@@ -0,0 +1,89 @@
+package top
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// EnterScreen switches to the alternate screen and hides the cursor.
+	EnterScreen = "\x1b[?1049h\x1b[?25l"
+	// LeaveScreen shows the cursor and switches back to the main screen.
+	LeaveScreen = "\x1b[?25h\x1b[?1049l"
+)
+
+// pollInterval are how long ReadKeys waits for the keys at once before checking if it should return.
+const pollInterval = 100 * time.Millisecond
+
+// Terminal are the terminal in raw mode, which passes the keys without echo as soon as they are typed.
+// The output are still processed, so that a newline moves to the beginning of the next line.
+type Terminal struct {
+	fd   int
+	orig *unix.Termios
+}
+
+// OpenTerminal turns the terminal of fd into raw mode.
+func OpenTerminal(fd int) (*Terminal, error) {
+	orig, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	raw := *orig
+	raw.Iflag &^= unix.IXON | unix.ICRNL
+	raw.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return &Terminal{fd: fd, orig: orig}, nil
+}
+
+// Size returns the width and the height of the terminal.
+func (t *Terminal) Size() (int, int, error) {
+	ws, err := unix.IoctlGetWinsize(t.fd, unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
+
+// Restore turns the terminal back into the mode before OpenTerminal.
+func (t *Terminal) Restore() error {
+	return unix.IoctlSetTermios(t.fd, unix.TCSETS, t.orig)
+}
+
+// ReadKeys sends the keys typed on the terminal to keys until done is closed or the terminal fails to be read,
+// and then closes keys. It returns within pollInterval after done is closed, so that nothing is read
+// after the terminal are restored.
+func (t *Terminal) ReadKeys(keys chan<- string, done <-chan struct{}) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	fds := []unix.PollFd{{Fd: int32(t.fd), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		n, err := unix.Poll(fds, int(pollInterval/time.Millisecond))
+		if err == unix.EINTR || n == 0 {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		n, err = unix.Read(t.fd, buf)
+		if err != nil || n == 0 {
+			return
+		}
+		for _, k := range ParseKeys(buf[:n]) {
+			select {
+			case keys <- k:
+			case <-done:
+				return
+			}
+		}
+	}
+}
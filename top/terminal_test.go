@@ -0,0 +1,39 @@
+package top
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTerminal_ReadKeys(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	term := &Terminal{fd: int(r.Fd())}
+	keys, done := make(chan string), make(chan struct{})
+	go term.ReadKeys(keys, done)
+
+	w.WriteString("q")
+	select {
+	case k := <-keys:
+		if k != "q" {
+			t.Errorf("the key should be %q, not %q", "q", k)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the key should be read")
+	}
+	// ReadKeys waiting for the keys returns once done is closed.
+	close(done)
+	select {
+	case _, ok := <-keys:
+		if ok {
+			t.Errorf("keys should be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadKeys should return after done is closed")
+	}
+}
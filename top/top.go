@@ -0,0 +1,466 @@
+package top
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+	"github.com/yuuki/lsconntrack/humanize"
+)
+
+// Column are the sortable columns.
+type Column int
+
+const (
+	// ColumnLocal are the local address and port.
+	ColumnLocal Column = iota
+	// ColumnPeer are the peer address and port.
+	ColumnPeer
+	// ColumnInBytes are the inbound bytes.
+	ColumnInBytes
+	// ColumnOutBytes are the outbound bytes.
+	ColumnOutBytes
+	// ColumnInRate are the inbound bytes per second.
+	ColumnInRate
+	// ColumnOutRate are the outbound bytes per second.
+	ColumnOutRate
+	// ColumnConns are the number of the connections.
+	ColumnConns
+)
+
+var columnNames = []string{"Local", "Peer", "Inbytes", "Outbytes", "In/s", "Out/s", "Conns"}
+
+// String returns the header of the column.
+func (c Column) String() string {
+	return columnNames[c]
+}
+
+// Action are what the caller should do after a key.
+type Action int
+
+const (
+	// ActionNone needs nothing but redrawing.
+	ActionNone Action = iota
+	// ActionQuit quits the UI.
+	ActionQuit
+	// ActionDrillDown shows the conntrack entries of the selected row by ShowEntries.
+	ActionDrillDown
+)
+
+// Row are a host flow with the rates since the previous update.
+type Row struct {
+	// Flow are the host flow with the numerical addresses.
+	Flow *conntrack.HostFlow
+	// Local and Peer are the endpoints to be displayed, whose addresses may be resolved into the names.
+	Local, Peer     string
+	InRate, OutRate float64
+	// New are whether the flow appears in the latest update.
+	New bool
+}
+
+// Model are the state of the UI: the rows, the sort order, the filters and the selection.
+type Model struct {
+	rows    []*Row
+	at      time.Time
+	prev    map[string]*conntrack.HostFlowStat
+	sortBy  Column
+	reverse bool
+	// names are the names resolved by the address in the latest update, not to look up the same addresses every refresh.
+	names map[string]string
+
+	// direction, port and peer are the filters. The zero values match any flows.
+	direction conntrack.FlowDirection
+	port      string
+	peer      string
+	// prompt are the name of the filter being typed, "peer" or "port", or empty.
+	prompt string
+	input  string
+
+	selected int
+	offset   int
+	// entries are the conntrack entries of the selected row on drill-down.
+	entries      []string
+	entriesTitle string
+	message      string
+}
+
+// NewModel returns the model sorted by the inbound rates.
+func NewModel() *Model {
+	return &Model{sortBy: ColumnInRate}
+}
+
+// Update replaces the rows by the flows at the time. The flows are numerical, and the addresses
+// to be displayed are replaced into the names by resolve unless it is nil. The names are cached
+// while the addresses keep appearing, so that resolve are called once for each address.
+func (m *Model) Update(flows conntrack.HostFlows, resolve func(string) string, at time.Time) {
+	var selected *conntrack.HostFlow
+	if r := m.Selected(); r != nil {
+		selected = r.Flow
+	}
+	names := map[string]string{}
+	cached := func(addr string) string {
+		name, ok := names[addr]
+		if !ok {
+			name, ok = m.names[addr]
+		}
+		if !ok {
+			name = resolve(addr)
+		}
+		names[addr] = name
+		return name
+	}
+	elapsed := at.Sub(m.at).Seconds()
+	rows := make([]*Row, 0, len(flows))
+	stats := make(map[string]*conntrack.HostFlowStat, len(flows))
+	for key, flow := range flows {
+		display := flow
+		if resolve != nil {
+			display = flow.Resolved(cached)
+		}
+		row := &Row{Flow: flow, Local: display.Local.String(), Peer: display.Peer.String()}
+		if prev, ok := m.prev[key]; ok && elapsed > 0 {
+			d := flow.Stat.Sub(prev)
+			row.InRate = float64(d.TotalInboundBytes) / elapsed
+			row.OutRate = float64(d.TotalOutboundBytes) / elapsed
+		} else if m.prev != nil {
+			row.New = true
+		}
+		rows = append(rows, row)
+		stats[key] = flow.Stat
+	}
+	m.rows, m.prev, m.names, m.at = rows, stats, names, at
+	m.follow(selected)
+}
+
+// follow selects the row of the flow again after the rows are updated or sorted.
+func (m *Model) follow(flow *conntrack.HostFlow) {
+	if flow == nil {
+		return
+	}
+	key := flow.UniqKey()
+	for i, r := range m.Visible() {
+		if r.Flow.UniqKey() == key {
+			m.selected = i
+			return
+		}
+	}
+}
+
+// Visible returns the rows matched by the filters in order of the sort column.
+// The selection are bounded by the rows.
+func (m *Model) Visible() []*Row {
+	var rows []*Row
+	for _, r := range m.rows {
+		if m.direction != 0 && r.Flow.Direction != m.direction {
+			continue
+		}
+		if m.port != "" && r.Flow.Local.Port != m.port && r.Flow.Peer.Port != m.port {
+			continue
+		}
+		if m.peer != "" && !strings.Contains(r.Peer, m.peer) && !strings.Contains(r.Flow.Peer.Addr, m.peer) {
+			continue
+		}
+		rows = append(rows, r)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		less, equal := m.compare(rows[i], rows[j])
+		if equal {
+			return rows[i].Flow.UniqKey() < rows[j].Flow.UniqKey()
+		}
+		return less != m.reverse
+	})
+	if m.selected >= len(rows) {
+		m.selected = len(rows) - 1
+	}
+	if m.selected < 0 {
+		m.selected = 0
+	}
+	return rows
+}
+
+// compare returns whether a goes before b in the default order of the sort column,
+// which are ascending by the endpoints and descending by the numbers.
+func (m *Model) compare(a, b *Row) (less bool, equal bool) {
+	var x, y float64
+	switch m.sortBy {
+	case ColumnLocal:
+		return a.Local < b.Local, a.Local == b.Local
+	case ColumnPeer:
+		return a.Peer < b.Peer, a.Peer == b.Peer
+	case ColumnInBytes:
+		x, y = float64(a.Flow.Stat.TotalInboundBytes), float64(b.Flow.Stat.TotalInboundBytes)
+	case ColumnOutBytes:
+		x, y = float64(a.Flow.Stat.TotalOutboundBytes), float64(b.Flow.Stat.TotalOutboundBytes)
+	case ColumnInRate:
+		x, y = a.InRate, b.InRate
+	case ColumnOutRate:
+		x, y = a.OutRate, b.OutRate
+	case ColumnConns:
+		x, y = float64(a.Flow.Stat.TotalConnections), float64(b.Flow.Stat.TotalConnections)
+	}
+	return x > y, x == y
+}
+
+// Selected returns the selected row, or nil if no rows are visible.
+func (m *Model) Selected() *Row {
+	rows := m.Visible()
+	if len(rows) == 0 {
+		return nil
+	}
+	return rows[m.selected]
+}
+
+// ShowEntries shows the conntrack entries of the selected row until a key is pressed.
+func (m *Model) ShowEntries(entries []string, err error) {
+	r := m.Selected()
+	if r == nil {
+		return
+	}
+	m.entriesTitle = fmt.Sprintf("conntrack entries of %s %s %s", r.Local, arrow(r.Flow), r.Peer)
+	if err != nil {
+		m.message = err.Error()
+		return
+	}
+	m.entries = entries
+	if m.entries == nil {
+		m.entries = []string{}
+	}
+}
+
+var directions = []conntrack.FlowDirection{0, conntrack.FlowActive, conntrack.FlowPassive, conntrack.FlowForwarded}
+
+// Key handles the key returned by ParseKeys.
+func (m *Model) Key(key string) Action {
+	m.message = ""
+	if m.entries != nil {
+		if key == KeyCtrlC {
+			return ActionQuit
+		}
+		// any keys go back to the flows.
+		m.entries = nil
+		return ActionNone
+	}
+	if m.prompt != "" {
+		switch key {
+		case KeyEnter:
+			if m.prompt == "peer" {
+				m.peer = m.input
+			} else {
+				m.port = m.input
+			}
+			m.prompt, m.input = "", ""
+		case KeyEsc:
+			m.prompt, m.input = "", ""
+		case KeyBackspace:
+			if len(m.input) > 0 {
+				m.input = m.input[:len(m.input)-1]
+			}
+		case KeyCtrlC:
+			return ActionQuit
+		default:
+			if len(key) == 1 {
+				m.input += key
+			}
+		}
+		return ActionNone
+	}
+
+	selected := m.Selected()
+	switch key {
+	case "q", KeyCtrlC:
+		return ActionQuit
+	case "1", "2", "3", "4", "5", "6", "7":
+		c := Column(key[0] - '1')
+		if c == m.sortBy {
+			m.reverse = !m.reverse
+		} else {
+			m.sortBy, m.reverse = c, false
+		}
+	case "r":
+		m.reverse = !m.reverse
+	case "d":
+		for i, d := range directions {
+			if d == m.direction {
+				m.direction = directions[(i+1)%len(directions)]
+				break
+			}
+		}
+	case "/":
+		m.prompt, m.input = "peer", m.peer
+	case ":":
+		m.prompt, m.input = "port", m.port
+	case "c", KeyEsc:
+		m.direction, m.port, m.peer = 0, "", ""
+	case KeyUp, "k":
+		if m.selected > 0 {
+			m.selected--
+		}
+		return ActionNone
+	case KeyDown, "j":
+		m.selected++
+		m.Visible() // bound the selection
+		return ActionNone
+	case KeyEnter:
+		if selected != nil {
+			return ActionDrillDown
+		}
+		return ActionNone
+	default:
+		return ActionNone
+	}
+	m.follow(flowOf(selected))
+	return ActionNone
+}
+
+func flowOf(r *Row) *conntrack.HostFlow {
+	if r == nil {
+		return nil
+	}
+	return r.Flow
+}
+
+// arrow returns the arrow from the client to the server of the flow.
+func arrow(flow *conntrack.HostFlow) string {
+	if flow.Direction == conntrack.FlowPassive {
+		return "<--"
+	}
+	return "-->"
+}
+
+const (
+	styleReset    = "\x1b[0m"
+	styleHeader   = "\x1b[1;7m"
+	styleSelected = "\x1b[7m"
+	styleNew      = "\x1b[1;32m"
+	styleNewSel   = "\x1b[1;32;7m"
+	clearLine     = "\x1b[K"
+)
+
+// rowFormat are the format of the columns of a row.
+const rowFormat = "%-26s %-3s %-30s %9s %9s %12s %12s %6s"
+
+// Render draws the screen of width and height from the top left corner.
+func (m *Model) Render(w io.Writer, width, height int) error {
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	// the lines are separated by the newlines, and the last line does not end with it
+	// not to scroll the screen of the height lines.
+	first := true
+	line := func(style, s string) {
+		if !first {
+			b.WriteString("\n")
+		}
+		first = false
+		if len(s) > width {
+			s = s[:width]
+		}
+		if style != "" {
+			b.WriteString(style + s + styleReset)
+		} else {
+			b.WriteString(s)
+		}
+		b.WriteString(clearLine)
+	}
+
+	if m.entries != nil {
+		line(styleHeader, fmt.Sprintf("%s (%d)", m.entriesTitle, len(m.entries)))
+		line("", "press any key to go back")
+		for i, e := range m.entries {
+			// the last line tells the rest unless all the entries fit the height.
+			if i >= height-3 && len(m.entries) > height-2 {
+				line("", fmt.Sprintf("... %d more", len(m.entries)-i))
+				break
+			}
+			line("", e)
+		}
+		b.WriteString("\x1b[J")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	rows := m.Visible()
+	order := "desc"
+	if (m.sortBy <= ColumnPeer) != m.reverse {
+		order = "asc"
+	}
+	status := fmt.Sprintf("lsconntrack top  %s  flows: %d/%d  sort: %s %s", m.at.Format("15:04:05"), len(rows), len(m.rows), m.sortBy, order)
+	if f := m.filters(); f != "" {
+		status += "  filter: " + f
+	}
+	line("", status)
+	line("", "1-7 sort  r reverse  d direction  / peer  : port  c clear  up/down select  enter entries  q quit")
+	line(styleHeader, fmt.Sprintf(rowFormat, "1:Local", "", "2:Peer", "3:Inbytes", "4:Outbytes", "5:In/s", "6:Out/s", "7:Conns"))
+
+	// the rows between the header and the prompt line.
+	n := height - 4
+	if n < 1 {
+		n = 1
+	}
+	if m.selected < m.offset {
+		m.offset = m.selected
+	}
+	if m.selected >= m.offset+n {
+		m.offset = m.selected - n + 1
+	}
+	if m.offset > len(rows) {
+		m.offset = 0
+	}
+	for i := m.offset; i < len(rows) && i < m.offset+n; i++ {
+		r := rows[i]
+		s := statColumns(r)
+		style := ""
+		switch {
+		case i == m.selected && r.New:
+			style = styleNewSel
+		case i == m.selected:
+			style = styleSelected
+		case r.New:
+			style = styleNew
+		}
+		line(style, fmt.Sprintf(rowFormat, r.Local, arrow(r.Flow), r.Peer, s[0], s[1], s[2], s[3], s[4]))
+	}
+	for i := len(rows) - m.offset; i < n; i++ {
+		line("", "")
+	}
+	switch {
+	case m.prompt != "":
+		line("", fmt.Sprintf("%s filter: %s_", m.prompt, m.input))
+	case m.message != "":
+		line("", m.message)
+	default:
+		line("", "")
+	}
+	b.WriteString("\x1b[J")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// statColumns returns the stat columns of the row.
+func statColumns(r *Row) [5]string {
+	s := r.Flow.Stat
+	return [5]string{
+		humanize.Bytes(s.TotalInboundBytes),
+		humanize.Bytes(s.TotalOutboundBytes),
+		humanize.ByteRate(r.InRate),
+		humanize.ByteRate(r.OutRate),
+		fmt.Sprint(s.TotalConnections),
+	}
+}
+
+// filters returns the description of the filters.
+func (m *Model) filters() string {
+	var fs []string
+	if m.direction != 0 {
+		fs = append(fs, "direction="+m.direction.String())
+	}
+	if m.port != "" {
+		fs = append(fs, "port="+m.port)
+	}
+	if m.peer != "" {
+		fs = append(fs, fmt.Sprintf("peer=%q", m.peer))
+	}
+	return strings.Join(fs, " ")
+}
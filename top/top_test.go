@@ -0,0 +1,211 @@
+package top
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack/conntracktest"
+)
+
+// the conntrack entries of mysql and web, whose inbound bytes increase by 2000 and 500 in the second round,
+// and redis appearing in the second round.
+const (
+	firstRound = `tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=1 bytes=100 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=1000 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 86399 ESTABLISHED src=10.0.2.10 dst=10.0.0.10 sport=52110 dport=80 packets=1 bytes=1000 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=52110 packets=1 bytes=100 [ASSURED] mark=0 secmark=0 use=1
+`
+	secondRound = `tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.10 sport=41143 dport=3306 packets=1 bytes=100 src=10.0.1.10 dst=10.0.0.10 sport=3306 dport=41143 packets=1 bytes=3000 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 86399 ESTABLISHED src=10.0.2.10 dst=10.0.0.10 sport=52110 dport=80 packets=1 bytes=1500 src=10.0.0.10 dst=10.0.2.10 sport=80 dport=52110 packets=1 bytes=100 [ASSURED] mark=0 secmark=0 use=1
+tcp      6 86399 ESTABLISHED src=10.0.0.10 dst=10.0.1.20 sport=41144 dport=6379 packets=1 bytes=100 src=10.0.1.20 dst=10.0.0.10 sport=6379 dport=41144 packets=1 bytes=10 [ASSURED] mark=0 secmark=0 use=1
+`
+)
+
+func peers(rows []*Row) []string {
+	var ps []string
+	for _, r := range rows {
+		ps = append(ps, r.Peer)
+	}
+	return ps
+}
+
+func TestModel_Update(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := NewModel()
+	m.Update(conntracktest.Web.Parse(t, firstRound), nil, at)
+	resolve := func(addr string) string {
+		if addr == "10.0.1.10" {
+			return "db-1"
+		}
+		return addr
+	}
+	m.Update(conntracktest.Web.Parse(t, secondRound), resolve, at.Add(2*time.Second))
+
+	rows := m.Visible()
+	expected := []string{"db-1:3306", "10.0.2.10:many", "10.0.1.20:6379"}
+	if got := peers(rows); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("rows should be sorted by the inbound rates %v, not %v", expected, got)
+	}
+	if rows[0].InRate != 1000 || rows[1].InRate != 250 {
+		t.Errorf("the inbound rates should be 1000 and 250, not %v and %v", rows[0].InRate, rows[1].InRate)
+	}
+	if rows[0].New || !rows[2].New {
+		t.Errorf("only the flow appearing in the latest update should be new")
+	}
+	if rows[0].Flow.Peer.Addr != "10.0.1.10" {
+		t.Errorf("the flow should keep the numerical address, not %v", rows[0].Flow.Peer.Addr)
+	}
+}
+
+func TestModel_Update_names(t *testing.T) {
+	lookups := map[string]int{}
+	resolve := func(addr string) string {
+		lookups[addr]++
+		return addr
+	}
+	m := NewModel()
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, entries := range []string{firstRound, secondRound, secondRound} {
+		m.Update(conntracktest.Web.Parse(t, entries), resolve, at.Add(time.Duration(i)*time.Second))
+	}
+	for _, addr := range []string{"10.0.1.10", "10.0.1.20", "10.0.2.10"} {
+		if lookups[addr] != 1 {
+			t.Errorf("%s should be resolved once, not %d times", addr, lookups[addr])
+		}
+	}
+	// the names of the addresses gone are not cached any more.
+	m.Update(conntracktest.Web.Parse(t, firstRound), resolve, at.Add(3*time.Second))
+	m.Update(conntracktest.Web.Parse(t, secondRound), resolve, at.Add(4*time.Second))
+	if lookups["10.0.1.20"] != 2 {
+		t.Errorf("10.0.1.20 appearing again should be resolved again, not %d times", lookups["10.0.1.20"])
+	}
+}
+
+func TestModel_Key(t *testing.T) {
+	tests := []struct {
+		desc     string
+		keys     []string
+		expected []string
+	}{
+		{"sort by peer", []string{"2"}, []string{"10.0.1.10:3306", "10.0.1.20:6379", "10.0.2.10:many"}},
+		{"reverse", []string{"2", "2"}, []string{"10.0.2.10:many", "10.0.1.20:6379", "10.0.1.10:3306"}},
+		{"active", []string{"2", "d"}, []string{"10.0.1.10:3306", "10.0.1.20:6379"}},
+		{"passive", []string{"d", "d"}, []string{"10.0.2.10:many"}},
+		{"port", []string{":", "8", "0", KeyEnter}, []string{"10.0.2.10:many"}},
+		{"peer", []string{"/", "1", ".", "2", "0", KeyEnter}, []string{"10.0.1.20:6379"}},
+		{"cancel", []string{"/", "1", ".", "2", KeyEsc}, []string{"10.0.1.10:3306", "10.0.2.10:many", "10.0.1.20:6379"}},
+		{"clear", []string{"d", ":", "8", "0", KeyEnter, "c"}, []string{"10.0.1.10:3306", "10.0.2.10:many", "10.0.1.20:6379"}},
+	}
+	for _, tc := range tests {
+		m := NewModel()
+		m.sortBy = ColumnInBytes
+		m.Update(conntracktest.Web.Parse(t, secondRound), nil, time.Now())
+		for _, k := range tc.keys {
+			m.Key(k)
+		}
+		if got := peers(m.Visible()); strings.Join(got, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("desc: %q, rows should be %v, not %v", tc.desc, tc.expected, got)
+		}
+	}
+}
+
+func TestModel_drillDown(t *testing.T) {
+	m := NewModel()
+	m.sortBy = ColumnInBytes
+	m.Update(conntracktest.Web.Parse(t, secondRound), nil, time.Now())
+	m.Key(KeyDown)
+	if action := m.Key(KeyEnter); action != ActionDrillDown {
+		t.Fatalf("enter should drill down, not %v", action)
+	}
+	if r := m.Selected(); r.Flow.Peer.Addr != "10.0.2.10" {
+		t.Fatalf("the selected row should be 10.0.2.10, not %v", r.Flow.Peer.Addr)
+	}
+	m.ShowEntries([]string{"tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80"}, nil)
+
+	var out bytes.Buffer
+	if err := m.Render(&out, 120, 20); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "conntrack entries of localhost:80 <-- 10.0.2.10:many (1)") ||
+		!strings.Contains(out.String(), "src=10.0.2.10 dst=10.0.0.10") {
+		t.Errorf("the entries should be rendered, got %q", out.String())
+	}
+	if action := m.Key("x"); action != ActionNone || m.entries != nil {
+		t.Errorf("any key should go back to the flows")
+	}
+	if action := m.Key("q"); action != ActionQuit {
+		t.Errorf("q should quit, not %v", action)
+	}
+}
+
+func TestModel_Render(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := NewModel()
+	m.Update(conntracktest.Web.Parse(t, firstRound), nil, at)
+	m.Update(conntracktest.Web.Parse(t, secondRound), nil, at.Add(2*time.Second))
+
+	var out bytes.Buffer
+	if err := m.Render(&out, 200, 8); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	tests := []struct {
+		desc     string
+		line     int
+		expected string
+	}{
+		{"status", 0, "lsconntrack top  03:04:07  flows: 3/3  sort: In/s desc"},
+		{"header", 2, styleHeader + "1:Local"},
+		{"selected", 3, styleSelected + "localhost:many             -->"},
+		{"rate", 3, "1000 B/s"},
+		{"new", 5, styleNew + "localhost:many"},
+	}
+	for _, tc := range tests {
+		if !strings.Contains(lines[tc.line], tc.expected) {
+			t.Errorf("desc: %q, line %d should contain %q, got %q", tc.desc, tc.line, tc.expected, lines[tc.line])
+		}
+	}
+	// the rows are limited to the height, and the last line does not end with the newline not to scroll.
+	m.Key("/")
+	out.Reset()
+	m.Render(&out, 40, 5)
+	lines = strings.Split(out.String(), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[4], "peer filter: _") {
+		t.Errorf("the screen should have 5 lines with the prompt at the last, got %q", lines)
+	}
+}
+
+func TestModel_Render_entries(t *testing.T) {
+	entry := "tcp      6 5 CLOSE src=10.0.2.10 dst=10.0.0.10 sport=41143 dport=80"
+	tests := []struct {
+		desc     string
+		entries  int
+		height   int
+		expected []string
+	}{
+		{"fit", 3, 5, []string{entry, entry, entry}},
+		{"more", 4, 5, []string{entry, entry, "... 2 more"}},
+	}
+	for _, tc := range tests {
+		m := NewModel()
+		m.Update(conntracktest.Web.Parse(t, secondRound), nil, time.Now())
+		var entries []string
+		for i := 0; i < tc.entries; i++ {
+			entries = append(entries, entry)
+		}
+		m.ShowEntries(entries, nil)
+		var out bytes.Buffer
+		if err := m.Render(&out, 120, tc.height); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(out.String(), "\n")
+		if len(lines) != tc.height {
+			t.Fatalf("desc: %q, the screen should have %d lines, got %q", tc.desc, tc.height, lines)
+		}
+		for i, expected := range tc.expected {
+			if !strings.Contains(lines[2+i], expected) {
+				t.Errorf("desc: %q, line %d should contain %q, got %q", tc.desc, 2+i, expected, lines[2+i])
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/yuuki/lsconntrack/conntrack"
+)
+
+// tick are a round of collecting the host flows in watch mode.
+type tick struct {
+	seq int
+	at  time.Time
+}
+
+// watcher repeats collecting the host flows at the interval.
+type watcher struct {
+	interval time.Duration
+	count    int
+}
+
+// setFlags defines the options on flags.
+func (w *watcher) setFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&w.interval, "watch", 0, "")
+	flags.IntVar(&w.count, "count", 0, "")
+}
+
+// enabled returns whether the watch mode is enabled.
+func (w *watcher) enabled() bool {
+	return w.interval > 0
+}
+
+// run collects the host flows by cl every interval until count ticks, or forever if count is 0,
+// and calls fn with each tick. It stops and returns the exit code unless fn returns exitCodeOK.
+func (w *watcher) run(cl *collector, fn func(t *tick, flows conntrack.HostFlows, resolve func(string) string) int) int {
+	if cl.stdin || cl.captureFile != "" || cl.snapshotFile != "" {
+		log.Println("--watch cannot be used with --stdin, --capture or --from-snapshot")
+		return exitCodeArgumentsError
+	}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for seq := 1; ; seq++ {
+		flows, resolve, status := cl.collect()
+		if status != exitCodeOK {
+			return status
+		}
+		if status := fn(&tick{seq: seq, at: cl.origin.collectedAt}, flows, resolve); status != exitCodeOK {
+			return status
+		}
+		if w.count > 0 && seq >= w.count {
+			return exitCodeOK
+		}
+		<-ticker.C
+	}
+}